@@ -0,0 +1,159 @@
+package zlog
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// batch collects entries for outputs which send them in batches, and sends
+// them if there are size entries or every interval.
+//
+// Batches are sent from a background goroutine, so that adding an entry
+// doesn't wait for the network. Only if the batch fills up again while the
+// previous one is still being sent does add() send it and wait, so the number
+// of collected entries is bounded.
+//
+// Entries are lost if sending fails; they're written to stderr together with
+// the error.
+type batch struct {
+	name string // For error messages.
+	size int
+	send func(...Log) error
+
+	mu     sync.Mutex
+	buf    []Log
+	closed bool
+	stop   chan struct{}
+	full   chan struct{}
+	wg     sync.WaitGroup
+
+	// Held while sending, so that batches are sent in order.
+	sendMu sync.Mutex
+}
+
+func newBatch(name string, size int, interval time.Duration, send func(...Log) error) *batch {
+	b := &batch{name: name, size: size, send: send,
+		stop: make(chan struct{}), full: make(chan struct{}, 1)}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-t.C:
+				b.flush()
+			case <-b.full:
+				b.flush()
+			}
+		}
+	}()
+	return b
+}
+
+// add an entry, sending the batch in the background if it's full. The entry is
+// sent right away if the batch is closed.
+func (b *batch) add(l Log) {
+	b.mu.Lock()
+	b.buf = append(b.buf, l)
+	n, closed := len(b.buf), b.closed
+	b.mu.Unlock()
+
+	switch {
+	case closed || n >= 2*b.size:
+		b.flush()
+	case n >= b.size:
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush sends all collected entries, waiting for a batch that's being sent in
+// the background.
+func (b *batch) flush() error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	b.mu.Lock()
+	ls := b.buf
+	b.buf = nil
+	b.mu.Unlock()
+
+	if len(ls) == 0 {
+		return nil
+	}
+	err := b.send(ls...)
+	if err != nil {
+		fmt.Fprintf(stderr, "zlog: %s: %s\n", b.name, err)
+		for _, l := range ls {
+			fmt.Fprintln(stderr, formatText(l, false))
+		}
+	}
+	return err
+}
+
+// close stops the timer and sends all collected entries.
+func (b *batch) close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.stop)
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return b.flush()
+}
+
+// retry calls f until it succeeds, or until it returns false for retry, or
+// after maxRetries retries, or if the next retry would be after maxTime since
+// the first call; a maxTime of 0 means there is no limit. The wait time starts
+// at minWait and doubles for every retry up to maxWait, unless f returns a wait
+// time.
+func retry(maxRetries int, minWait, maxWait, maxTime time.Duration, f func() (retry bool, wait time.Duration, err error)) error {
+	var (
+		backoff = minWait
+		start   = time.Now()
+	)
+	for i := 0; ; i++ {
+		retry, wait, err := f()
+		if err == nil || !retry || i >= maxRetries {
+			return err
+		}
+
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+			if backoff > maxWait {
+				backoff = maxWait
+			}
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+		if maxTime > 0 && time.Since(start)+wait > maxTime {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// retryAfter gets the wait time from the Retry-After header, if it's set to a
+// number of seconds.
+func retryAfter(h http.Header) time.Duration {
+	s, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || s <= 0 {
+		return 0
+	}
+	return time.Duration(s) * time.Second
+}
@@ -0,0 +1,144 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent [][]string
+	)
+	send := func(ls ...Log) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var msgs []string
+		for _, l := range ls {
+			msgs = append(msgs, l.Msg)
+		}
+		sent = append(sent, msgs)
+		return nil
+	}
+	get := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := make([]string, 0, len(sent))
+		for _, s := range sent {
+			out = append(out, strings.Join(s, " "))
+		}
+		sent = nil
+		return strings.Join(out, " | ")
+	}
+
+	// wait until something is sent in the background.
+	wait := func() string {
+		for i := 0; i < 500; i++ {
+			if got := get(); got != "" {
+				return got
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return ""
+	}
+
+	b := newBatch("test", 3, time.Hour, send)
+	for _, m := range []string{"1", "2", "3"} {
+		b.add(Log{Msg: m})
+	}
+	if got := wait(); got != "1 2 3" {
+		t.Errorf("after add: %q", got)
+	}
+	b.add(Log{Msg: "4"})
+	b.add(Log{Msg: "5"})
+	if err := b.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got != "4 5" {
+		t.Errorf("after flush: %q", got)
+	}
+	if err := b.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got != "" {
+		t.Errorf("empty flush: %q", got)
+	}
+
+	b.add(Log{Msg: "6"})
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	b.add(Log{Msg: "7"})
+	if got := get(); got != "6 | 7" {
+		t.Errorf("after close: %q", got)
+	}
+
+	t.Run("interval", func(t *testing.T) {
+		b := newBatch("test", 100, 10*time.Millisecond, send)
+		defer b.close()
+		b.add(Log{Msg: "1"})
+		if got := wait(); got != "1" {
+			t.Errorf("wrong: %q", got)
+		}
+	})
+
+	t.Run("no block", func(t *testing.T) {
+		var (
+			unblock = make(chan struct{})
+			started = make(chan struct{}, 10)
+		)
+		b := newBatch("test", 2, time.Hour, func(ls ...Log) error {
+			started <- struct{}{}
+			<-unblock
+			return send(ls...)
+		})
+		b.add(Log{Msg: "1"})
+		b.add(Log{Msg: "2"})
+		<-started
+
+		// Adding doesn't wait for the batch that's being sent, until the next
+		// batch is full too.
+		done := make(chan struct{})
+		go func() {
+			for _, m := range []string{"3", "4", "5"} {
+				b.add(Log{Msg: m})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("add blocked")
+		}
+
+		close(unblock)
+		if err := b.close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := get(); got != "1 2 | 3 4 5" {
+			t.Errorf("wrong: %q", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		stderr = buf
+		defer func() { stderr = os.Stderr }()
+
+		b := newBatch("test", 2, time.Hour, func(...Log) error { return errors.New("oh noes") })
+		defer b.close()
+		b.add(Log{Msg: "1"})
+		b.add(Log{Msg: "2"})
+		b.flush()
+
+		out := buf.String()
+		if !strings.HasPrefix(out, "zlog: test: oh noes\n") || !strings.Contains(out, "1\n") || !strings.Contains(out, "2\n") {
+			t.Errorf("wrong output:\n%s", out)
+		}
+	})
+}
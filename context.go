@@ -0,0 +1,84 @@
+package zlog
+
+import "context"
+
+type ctxKey int
+
+const (
+	ctxLog ctxKey = iota
+	ctxRequestID
+	ctxTrace
+)
+
+// NewContext returns a new context with the Log stored in it.
+func NewContext(ctx context.Context, l Log) context.Context {
+	return context.WithValue(ctx, ctxLog, l)
+}
+
+// FromContext gets the Log stored in the context with NewContext().
+//
+// The Log's Ctx is set to ctx, so that outputs can read values from it. This
+// returns an empty Log if there is no Log in the context.
+func FromContext(ctx context.Context) Log {
+	l, ok := ctx.Value(ctxLog).(Log)
+	if !ok {
+		return Log{}
+	}
+	l.Ctx = ctx
+	return l
+}
+
+// WithRequestID returns a new context with the request ID stored in it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxRequestID, id)
+}
+
+// RequestID gets the request ID stored with WithRequestID(); this returns an
+// empty string if ctx is nil or there is no request ID.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxRequestID).(string)
+	return id
+}
+
+type traceIDs struct{ trace, span string }
+
+// WithTraceID returns a new context with the trace and span ID stored in it.
+//
+// These are expected to be hex-encoded W3C trace context IDs (32 characters
+// for the trace ID, 16 characters for the span ID), although this isn't
+// checked.
+func WithTraceID(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, ctxTrace, traceIDs{trace: traceID, span: spanID})
+}
+
+// TraceID gets the trace and span ID stored with WithTraceID(); this returns
+// empty strings if ctx is nil or there are no IDs.
+func TraceID(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return "", ""
+	}
+	t, _ := ctx.Value(ctxTrace).(traceIDs)
+	return t.trace, t.span
+}
+
+// ctxFields gets the request and trace IDs from the context, in a fixed
+// order; this is used by the structured formats.
+//
+// Fields which are also in data are skipped, for formats which write the
+// context and Data fields together; HTTPLog() sets request_id in both.
+func ctxFields(ctx context.Context, data F) [][2]string {
+	var f [][2]string
+	add := func(k, v string) {
+		if _, ok := data[k]; v != "" && !ok {
+			f = append(f, [2]string{k, v})
+		}
+	}
+	add("request_id", RequestID(ctx))
+	trace, span := TraceID(ctx)
+	add("trace_id", trace)
+	add("span_id", span)
+	return f
+}
@@ -0,0 +1,53 @@
+package zlog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if l := FromContext(ctx); l.Modules != nil || l.Ctx != nil {
+		t.Errorf("not empty: %#v", l)
+	}
+
+	ctx = NewContext(ctx, Module("test").Field("k", "v"))
+	ctx = WithRequestID(ctx, "req1")
+	ctx = WithTraceID(ctx, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+
+	l := FromContext(ctx)
+	if l.Modules[0] != "test" || l.Data["k"] != "v" || l.Ctx != ctx {
+		t.Errorf("wrong log: %#v", l)
+	}
+	if id := RequestID(l.Ctx); id != "req1" {
+		t.Errorf("request ID %q", id)
+	}
+	if tr, sp := TraceID(l.Ctx); tr != "4bf92f3577b34da6a3ce929d0e0e4736" || sp != "00f067aa0ba902b7" {
+		t.Errorf("trace ID %q %q", tr, sp)
+	}
+	if id := RequestID(nil); id != "" {
+		t.Errorf("request ID %q", id)
+	}
+
+	l2 := Module("x").Context(ctx)
+	if l2.Ctx != ctx {
+		t.Error("Context() didn't set context")
+	}
+
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+	l.Msg = "w00t"
+
+	want := `{"time":"2020-06-18T13:14:15Z","level":"info","modules":["test"],"msg":"w00t","request_id":"req1",` +
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","data":{"k":"v"}}`
+	if out := FormatJSON(l); out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+	want = `time=2020-06-18T13:14:15Z level=info module=test msg=w00t request_id=req1 ` +
+		`trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7 k=v`
+	if out := FormatLogfmt(l); out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
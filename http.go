@@ -0,0 +1,175 @@
+package zlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPOptions are options for HTTPLog().
+type HTTPOptions struct {
+	// Log to use as the base for all requests. The default is Module("http").
+	Log Log
+
+	// Header to read the request ID from, and to set the request ID in the
+	// response. A new ID is generated if the header isn't in the request. The
+	// default is "X-Request-Id".
+	RequestIDHeader string
+
+	// Don't log requests to these paths, such as health checks.
+	SkipPaths []string
+}
+
+// HTTPLog is a middleware which logs every request.
+//
+// A Log with the request ID as "request_id" field is stored in the request
+// context, which can be retrieved with RequestLog() or FromContext(). The
+// request ID is also stored in the context, see RequestID(). After the request an entry
+// is logged with the fields from FieldsRequest() and the status, number of
+// bytes written, and duration; requests which return a 5xx status are logged as
+// errors.
+//
+//	http.ListenAndServe(":8080", zlog.HTTPLog(zlog.HTTPOptions{
+//	    SkipPaths: []string{"/health"},
+//	})(mux))
+func HTTPLog(opts HTTPOptions) func(http.Handler) http.Handler {
+	if opts.Log.Modules == nil {
+		opts.Log = opts.Log.Module("http")
+	}
+	if opts.RequestIDHeader == "" {
+		opts.RequestIDHeader = "X-Request-Id"
+	}
+	skip := make(map[string]struct{}, len(opts.SkipPaths))
+	for _, p := range opts.SkipPaths {
+		skip[p] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := skip[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			id := r.Header.Get(opts.RequestIDHeader)
+			if id == "" {
+				id = newRequestID()
+			}
+			w.Header().Set(opts.RequestIDHeader, id)
+
+			// Fields() modifies the map in-place, so always copy it.
+			l := opts.Log
+			l.Data = copyFields(opts.Log.Data, F{"request_id": id})
+			ctx := WithRequestID(r.Context(), id)
+			l.Ctx = ctx
+			ww, wrapped := wrapResponseWriter(w)
+			next.ServeHTTP(wrapped, r.WithContext(NewContext(ctx, l)))
+
+			if ww.status == 0 {
+				ww.status = http.StatusOK
+			}
+			l.Data = copyFields(l.Data, nil)
+			l = l.FieldsRequest(r).Fields(F{
+				"http_remote":   r.RemoteAddr,
+				"http_status":   ww.status,
+				"http_bytes":    ww.bytes,
+				"http_duration": time.Since(start),
+			})
+			if ww.status >= 500 {
+				l.Errorf("%s %s %d", r.Method, r.URL.Path, ww.status)
+			} else {
+				l.Printf("%s %s %d", r.Method, r.URL.Path, ww.status)
+			}
+		})
+	}
+}
+
+// RequestLog gets the Log stored in the request context by HTTPLog().
+//
+// This returns a Log without any modules or fields if there is no Log.
+func RequestLog(r *http.Request) Log { return FromContext(r.Context()) }
+
+// copyFields creates a new F with all fields from a and b.
+func copyFields(a, b F) F {
+	f := make(F, len(a)+len(b))
+	for k, v := range a {
+		f[k] = v
+	}
+	for k, v := range b {
+		f[k] = v
+	}
+	return f
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseWriter records the status and number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// The responseWriter with http.Flusher and http.Hijacker, so that these are
+// only implemented if the original ResponseWriter does.
+type (
+	flushWriter struct {
+		*responseWriter
+		http.Flusher
+	}
+	hijackWriter struct {
+		*responseWriter
+		http.Hijacker
+	}
+	flushHijackWriter struct {
+		*responseWriter
+		http.Flusher
+		http.Hijacker
+	}
+)
+
+// wrapResponseWriter wraps w in a responseWriter, implementing the same
+// optional interfaces as w.
+func wrapResponseWriter(w http.ResponseWriter) (*responseWriter, http.ResponseWriter) {
+	rw := &responseWriter{ResponseWriter: w}
+	f, isFlusher := w.(http.Flusher)
+	h, isHijacker := w.(http.Hijacker)
+	switch {
+	case isFlusher && isHijacker:
+		return rw, flushHijackWriter{rw, f, h}
+	case isFlusher:
+		return rw, flushWriter{rw, f}
+	case isHijacker:
+		return rw, hijackWriter{rw, h}
+	default:
+		return rw, rw
+	}
+}
@@ -0,0 +1,128 @@
+package zlog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPLog(t *testing.T) {
+	var got []Log
+	Config.Outputs = []OutputFunc{func(l Log) { got = append(got, l) }}
+
+	var reqLog Log
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		reqLog = RequestLog(r)
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	h := HTTPLog(HTTPOptions{SkipPaths: []string{"/health"}})(mux)
+
+	tests := []struct {
+		path, reqID string
+		wantLevel   int
+		wantStatus  int
+		wantBytes   int
+	}{
+		{"/", "", LevelInfo, 200, 5},
+		{"/?x=y", "abc", LevelInfo, 200, 5},
+		{"/fail", "", LevelErr, 502, 0},
+		{"/health", "", -1, 0, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			got, reqLog = nil, Log{}
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.reqID != "" {
+				r.Header.Set("X-Request-Id", tt.reqID)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if tt.wantLevel == -1 {
+				if len(got) != 0 {
+					t.Fatalf("logged: %v", got)
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("logged %d entries", len(got))
+			}
+
+			l := got[0]
+			id := rr.Header().Get("X-Request-Id")
+			if id == "" || (tt.reqID != "" && id != tt.reqID) {
+				t.Errorf("request ID %q", id)
+			}
+			if l.Data["request_id"] != id {
+				t.Errorf("request_id field %q; header %q", l.Data["request_id"], id)
+			}
+			if n := strings.Count(FormatLogfmt(l), "request_id="); n != 1 {
+				t.Errorf("request_id %d times in logfmt: %s", n, FormatLogfmt(l))
+			}
+			if tt.path == "/" && (reqLog.Data["request_id"] != id || RequestID(reqLog.Ctx) != id) {
+				t.Errorf("RequestLog request_id field %q; header %q", reqLog.Data["request_id"], id)
+			}
+			if l.Level != tt.wantLevel {
+				t.Errorf("level %d; want %d", l.Level, tt.wantLevel)
+			}
+			if l.Data["http_status"] != tt.wantStatus || l.Data["http_bytes"] != tt.wantBytes {
+				t.Errorf("status %v; bytes %v", l.Data["http_status"], l.Data["http_bytes"])
+			}
+			if _, ok := l.Data["http_duration"].(time.Duration); !ok {
+				t.Errorf("http_duration: %#v", l.Data["http_duration"])
+			}
+			if l.Data["http_url"] != tt.path || strings.Join(l.Modules, ":") != "http" {
+				t.Errorf("url %v; modules %v", l.Data["http_url"], l.Modules)
+			}
+		})
+	}
+}
+
+type plainWriter struct{ h http.Header }
+
+func (w *plainWriter) Header() http.Header         { return w.h }
+func (w *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainWriter) WriteHeader(int)             {}
+
+type hijackRecorder struct{ *httptest.ResponseRecorder }
+
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) { return nil, nil, nil }
+
+func TestHTTPLogInterfaces(t *testing.T) {
+	defer func(o []OutputFunc) { Config.Outputs = o }(Config.Outputs)
+	Config.Outputs = nil
+
+	var isFlusher, isHijacker bool
+	h := HTTPLog(HTTPOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher = w.(http.Flusher)
+		_, isHijacker = w.(http.Hijacker)
+	}))
+
+	tests := []struct {
+		w                 http.ResponseWriter
+		flusher, hijacker bool
+	}{
+		{&plainWriter{h: make(http.Header)}, false, false},
+		{httptest.NewRecorder(), true, false},
+		{hijackRecorder{httptest.NewRecorder()}, true, true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			h.ServeHTTP(tt.w, httptest.NewRequest("GET", "/", nil))
+			if isFlusher != tt.flusher || isHijacker != tt.hijacker {
+				t.Errorf("flusher %t, hijacker %t; want %t, %t", isFlusher, isHijacker, tt.flusher, tt.hijacker)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+func (j *JournaldOutput) send(b []byte) error {
+	_, err := j.conn.Write(b)
+	if err == nil || !(errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)) {
+		return err
+	}
+
+	// Too large for a datagram: write to an unlinked temporary file and pass
+	// the file descriptor. /dev/shm is what systemd uses.
+	fp, err := ioutil.TempFile("/dev/shm", "zlog-journal-")
+	if err != nil {
+		fp, err = ioutil.TempFile("", "zlog-journal-")
+		if err != nil {
+			return err
+		}
+	}
+	defer fp.Close()
+	if err := os.Remove(fp.Name()); err != nil {
+		return err
+	}
+	if _, err := fp.Write(b); err != nil {
+		return err
+	}
+
+	// WriteMsgUnix() refuses to write to a connected datagram socket, so use
+	// sendmsg() directly.
+	rc, err := j.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		serr = syscall.Sendmsg(int(fd), nil, syscall.UnixRights(int(fp.Fd())), nil, 0)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// journalStream reports if stderr is connected to the journal.
+func journalStream() bool {
+	js := os.Getenv("JOURNAL_STREAM")
+	if js == "" {
+		return false
+	}
+
+	st, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return js == fmt.Sprintf("%d:%d", sys.Dev, sys.Ino)
+}
@@ -0,0 +1,131 @@
+package zlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournaldOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "socket")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	j, err := NewJournaldOutput(JournaldOptions{Socket: sock, Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	read := func() string {
+		t.Helper()
+		ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf, oob := make([]byte, 4096), make([]byte, 128)
+		n, oobn, _, _, err := ln.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 0 {
+			return string(buf[:n])
+		}
+
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp := os.NewFile(uintptr(fds[0]), "fd")
+		defer fp.Close()
+		fp.Seek(0, 0)
+		b, err := ioutil.ReadAll(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	j.Write(Log{Msg: "w00t", Data: F{"k": "v"}})
+	if got := read(); !strings.HasPrefix(got, "MESSAGE=w00t\nPRIORITY=6\nSYSLOG_IDENTIFIER=app\n") || !strings.HasSuffix(got, "\nK=v\n") {
+		t.Errorf("wrong message: %q", got)
+	}
+
+	// Location of the caller of the log package.
+	Config.SetOutputs(j.Write)
+	defer Config.SetOutputs(output)
+	NewWriter(Log{}, LevelInfo).StdLogger().Print("std")
+	if got := read(); !strings.Contains(got, "journald_linux_test.go\n") ||
+		!strings.Contains(got, "\nCODE_FUNC=zgo.at/zlog.TestJournaldOutput\n") {
+		t.Errorf("wrong location: %q", got)
+	}
+
+	// The default output uses the journal, unless Config.Format is changed.
+	defaultJournalOnce.Do(func() {})
+	defaultJournal = j
+	defer func() { defaultJournal = nil }()
+	output(Log{Msg: "default"})
+	if got := read(); !strings.HasPrefix(got, "MESSAGE=default\n") {
+		t.Errorf("wrong message: %q", got)
+	}
+
+	stdout, err := ioutil.TempFile(dir, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, stdout = stdout, os.Stdout
+	Config.Format = func(l Log) string { return "custom " + l.Msg }
+	output(Log{Msg: "x"})
+	Config.Format = format
+	os.Stdout, stdout = stdout, os.Stdout
+	stdout.Close()
+	if got, _ := ioutil.ReadFile(stdout.Name()); string(got) != "custom x\n" {
+		t.Errorf("wrong stdout: %q", got)
+	}
+
+	// Too large for a datagram.
+	big := strings.Repeat("x", 1<<20)
+	j.Write(Log{Msg: big})
+	if got := read(); !strings.HasPrefix(got, "MESSAGE="+big+"\nPRIORITY=6\n") {
+		t.Errorf("wrong message: %q…", got[:50])
+	}
+}
+
+func TestJournalStream(t *testing.T) {
+	defer os.Unsetenv("JOURNAL_STREAM")
+
+	st, err := os.Stderr.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := st.Sys().(*syscall.Stat_t)
+
+	os.Setenv("JOURNAL_STREAM", "")
+	if journalStream() {
+		t.Error("true for empty JOURNAL_STREAM")
+	}
+	os.Setenv("JOURNAL_STREAM", "1:1")
+	if journalStream() {
+		t.Error("true for wrong JOURNAL_STREAM")
+	}
+	os.Setenv("JOURNAL_STREAM", fmt.Sprintf("%d:%d", sys.Dev, sys.Ino))
+	if !journalStream() {
+		t.Error("false for correct JOURNAL_STREAM")
+	}
+}
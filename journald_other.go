@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package zlog
+
+func (j *JournaldOutput) send(b []byte) error {
+	_, err := j.conn.Write(b)
+	return err
+}
+
+func journalStream() bool { return false }
@@ -0,0 +1,244 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Minimal MessagePack encoder, for the Fluent forward protocol. There's only
+// just enough decoding to read the ack responses.
+
+func mpNil(b []byte) []byte { return append(b, 0xc0) }
+
+func mpBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func mpInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return mpUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(b, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		return mpUint32(append(b, 0xd2), uint32(v))
+	default:
+		return mpUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+func mpUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return mpUint32(append(b, 0xce), uint32(v))
+	default:
+		return mpUint64(append(b, 0xcf), v)
+	}
+}
+
+func mpFloat(b []byte, v float64) []byte {
+	return mpUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func mpString(b []byte, v string) []byte {
+	n := len(v)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = mpUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func mpBin(b []byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5, byte(n>>8), byte(n))
+	default:
+		b = mpUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func mpArray(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return mpUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func mpMap(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return mpUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// mpEventTime writes the Fluent EventTime extension type: a fixext8 with type
+// 0, and the seconds and nanoseconds as 32-bit big endian integers.
+func mpEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = mpUint32(b, uint32(t.Unix()))
+	return mpUint32(b, uint32(t.Nanosecond()))
+}
+
+// mpValue writes any value; types without a MessagePack equivalent are written
+// as a string with fmt's %v.
+func mpValue(b []byte, v interface{}) []byte {
+	switch vv := v.(type) {
+	case nil:
+		return mpNil(b)
+	case bool:
+		return mpBool(b, vv)
+	case int:
+		return mpInt(b, int64(vv))
+	case int8:
+		return mpInt(b, int64(vv))
+	case int16:
+		return mpInt(b, int64(vv))
+	case int32:
+		return mpInt(b, int64(vv))
+	case int64:
+		return mpInt(b, vv)
+	case uint:
+		return mpUint(b, uint64(vv))
+	case uint8:
+		return mpUint(b, uint64(vv))
+	case uint16:
+		return mpUint(b, uint64(vv))
+	case uint32:
+		return mpUint(b, uint64(vv))
+	case uint64:
+		return mpUint(b, vv)
+	case float32:
+		return mpFloat(b, float64(vv))
+	case float64:
+		return mpFloat(b, vv)
+	case string:
+		return mpString(b, vv)
+	case []byte:
+		return mpString(b, string(vv))
+	case []rune:
+		return mpString(b, string(vv))
+	case JSON:
+		return mpString(b, string(vv))
+	case error:
+		return mpString(b, vv.Error())
+	case []string:
+		b = mpArray(b, len(vv))
+		for _, s := range vv {
+			b = mpString(b, s)
+		}
+		return b
+	default:
+		return mpString(b, fmt.Sprintf("%v", v))
+	}
+}
+
+func mpUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func mpUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+var errMsgpack = errors.New("unsupported or invalid msgpack")
+
+// mpReadStringMap reads a map with only string keys and values, which is all
+// we need to read the Fluent ack responses.
+func mpReadStringMap(r io.Reader) (map[string]string, error) {
+	n, err := mpReadLen(r, 0x80, 0xf0, 0, 0xde, 0xdf)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := mpReadString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := mpReadString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func mpReadString(r io.Reader) (string, error) {
+	n, err := mpReadLen(r, 0xa0, 0xe0, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<16 {
+		return "", errMsgpack
+	}
+	s := make([]byte, n)
+	_, err = io.ReadFull(r, s)
+	return string(s), err
+}
+
+// mpReadLen reads the length of a string or map: fix and mask are the type
+// byte and mask for the fix type, and s8, s16, s32 the type bytes with a 8, 16,
+// or 32-bit length (0 if there is no such type).
+func mpReadLen(r io.Reader, fix, mask, s8, s16, s32 byte) (int, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, err
+	}
+
+	t := buf[0]
+	switch {
+	case t&mask == fix:
+		return int(t &^ mask), nil
+	case s8 != 0 && t == s8:
+		_, err := io.ReadFull(r, buf[:1])
+		return int(buf[0]), err
+	case t == s16:
+		_, err := io.ReadFull(r, buf[:2])
+		return int(binary.BigEndian.Uint16(buf[:2])), err
+	case t == s32:
+		_, err := io.ReadFull(r, buf[:4])
+		return int(binary.BigEndian.Uint32(buf[:4])), err
+	}
+	return 0, errMsgpack
+}
@@ -0,0 +1,181 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpack(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456789, time.UTC)
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{mpNil(nil), "c0"},
+		{mpBool(nil, true), "c3"},
+		{mpInt(nil, 0), "00"},
+		{mpInt(nil, 127), "7f"},
+		{mpInt(nil, 128), "cc80"},
+		{mpInt(nil, 256), "cd0100"},
+		{mpInt(nil, 1<<16), "ce00010000"},
+		{mpInt(nil, 1<<32), "cf0000000100000000"},
+		{mpInt(nil, -1), "ff"},
+		{mpInt(nil, -32), "e0"},
+		{mpInt(nil, -33), "d0df"},
+		{mpInt(nil, -129), "d1ff7f"},
+		{mpInt(nil, math.MinInt32), "d280000000"},
+		{mpInt(nil, math.MinInt64), "d38000000000000000"},
+		{mpFloat(nil, 1.5), "cb3ff8000000000000"},
+		{mpString(nil, "abc"), "a3616263"},
+		{mpString(nil, strings.Repeat("a", 32))[:2], "d920"},
+		{mpString(nil, strings.Repeat("a", 256))[:3], "da0100"},
+		{mpBin(nil, []byte{1}), "c40101"},
+		{mpArray(nil, 2), "92"},
+		{mpArray(nil, 16), "dc0010"},
+		{mpMap(nil, 1), "81"},
+		{mpMap(nil, 16), "de0010"},
+		{mpEventTime(nil, n), "d7005eeb68a7075bcd15"},
+		{mpValue(nil, []string{"a"}), "91a161"},
+		{mpValue(nil, errors.New("e")), "a165"},
+		{mpValue(nil, struct{ A int }{1}), "a3" + fmt.Sprintf("%x", "{1}")},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			if got := fmt.Sprintf("%x", tt.in); got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMpReadStringMap(t *testing.T) {
+	b := mpString(mpString(mpMap(nil, 2), "ack"), "abc")
+	b = mpString(mpString(b, strings.Repeat("k", 40)), strings.Repeat("v", 300))
+	got, err := mpReadStringMap(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"ack": "abc", strings.Repeat("k", 40): strings.Repeat("v", 300)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+
+	for _, b := range [][]byte{
+		{},
+		mpArray(nil, 1),
+		mpInt(mpString(mpMap(nil, 1), "k"), 1),
+		mpString(mpMap(nil, 1), "k"),
+		{0x00},
+	} {
+		if _, err := mpReadStringMap(bytes.NewReader(b)); err == nil {
+			t.Errorf("no error for %x", b)
+		}
+	}
+}
+
+// mpDecode decodes one value; integers are returned as int64, maps as
+// map[string]interface{}, and the EventTime extension as time.Time.
+func mpDecode(r *bufio.Reader) (interface{}, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, rerr := io.ReadFull(r, b); rerr != nil {
+			err = rerr
+		}
+		return b
+	}
+	length := func(n int) int {
+		b := read(n)
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	array := func(n int) (interface{}, error) {
+		a := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := mpDecode(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	}
+	mapp := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := mpDecode(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := mpDecode(r)
+			if err != nil {
+				return nil, err
+			}
+			m[k.(string)] = v
+		}
+		return m, nil
+	}
+
+	switch {
+	case t < 0x80:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return mapp(int(t & 0x0f))
+	case t&0xf0 == 0x90:
+		return array(int(t & 0x0f))
+	case t&0xe0 == 0xa0:
+		return string(read(int(t & 0x1f))), err
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return t == 0xc3, nil
+	case 0xc4, 0xc5, 0xc6:
+		return read(length(1 << (t - 0xc4))), err
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(read(8))), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return int64(length(1 << (t - 0xcc))), err
+	case 0xd0:
+		return int64(int8(read(1)[0])), err
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(read(2)))), err
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(read(4)))), err
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(read(8))), err
+	case 0xd7:
+		b := read(9)
+		if b[0] != 0 {
+			return nil, fmt.Errorf("unknown ext type %d", b[0])
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b[1:5])), int64(binary.BigEndian.Uint32(b[5:]))).UTC(), err
+	case 0xd9, 0xda, 0xdb:
+		return string(read(length(1 << (t - 0xd9)))), err
+	case 0xdc, 0xdd:
+		return array(length(2 << (t - 0xdc)))
+	case 0xde, 0xdf:
+		return mapp(length(2 << (t - 0xde)))
+	}
+	return nil, fmt.Errorf("unsupported type %x", t)
+}
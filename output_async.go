@@ -0,0 +1,250 @@
+package zlog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow policies for AsyncOutput, used when the queue is full.
+const (
+	OverflowBlock      = iota // Block until there is space in the queue.
+	OverflowDropNewest        // Drop the entry that's being logged.
+	OverflowDropOldest        // Drop the oldest entry in the queue.
+	OverflowDropBelow         // Drop entries below AsyncOptions.DropBelow, and block for others.
+)
+
+// AsyncOptions are options for NewAsyncOutput() and NewAsyncSink().
+type AsyncOptions struct {
+	// Maximum number of entries in the queue; the default is 1024.
+	QueueSize int
+
+	// Number of goroutines calling the output; the default is 1. The order of
+	// entries isn't guaranteed if this is higher than 1, and the output must be
+	// safe for concurrent use.
+	Workers int
+
+	// What to do when the queue is full; the default is OverflowBlock.
+	Overflow int
+
+	// Entries with a level below this are dropped if the queue is full; only
+	// used with OverflowDropBelow.
+	DropBelow int
+
+	// Interval to log the number of dropped entries, if any were dropped. This
+	// is logged as a warning for the "zlog" module with Config.RunOutputs(), so
+	// it's written to all outputs and sinks. The default is every minute; set
+	// to a negative value to never log this.
+	ReportInterval time.Duration
+}
+
+// AsyncOutput sends entries to an output from a background goroutine, so that
+// slow outputs don't block the logging goroutine:
+//
+//	a := zlog.NewAsyncOutput(shipToHTTP, zlog.AsyncOptions{
+//	    Overflow: zlog.OverflowDropOldest,
+//	})
+//	zlog.Config.AppendSinks(a)
+//	defer zlog.Shutdown(context.Background())
+//
+// Use NewAsyncSink() for a Sink; Flush() and Close() are forwarded to the
+// Sink. The network outputs which send in batches already do this in the
+// background (see Sink), but others don't:
+//
+//	gelf, err := zlog.NewGELFOutput(zlog.GELFOptions{Network: "tcp"})
+//	if err != nil {
+//	    panic(err)
+//	}
+//	zlog.Config.AppendSinks(zlog.NewAsyncSink(gelf, zlog.AsyncOptions{}))
+type AsyncOutput struct {
+	dropped    uint64 // Accessed atomically; keep first for alignment.
+	unreported uint64
+
+	out   Sink
+	opts  AsyncOptions
+	queue chan Log
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex // Protects closed.
+	closed bool
+
+	pendMu  sync.Mutex
+	pending int // Entries queued or being written.
+	done    *sync.Cond
+}
+
+// NewAsyncOutput creates a new async output for out and starts the workers.
+func NewAsyncOutput(out OutputFunc, opts AsyncOptions) *AsyncOutput {
+	return NewAsyncSink(funcSink(out), opts)
+}
+
+// NewAsyncSink creates a new async output for the sink and starts the workers.
+func NewAsyncSink(out Sink, opts AsyncOptions) *AsyncOutput {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.ReportInterval == 0 {
+		opts.ReportInterval = time.Minute
+	}
+
+	a := &AsyncOutput{
+		out:   out,
+		opts:  opts,
+		queue: make(chan Log, opts.QueueSize),
+		stop:  make(chan struct{}),
+	}
+	a.done = sync.NewCond(&a.pendMu)
+
+	a.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer a.wg.Done()
+			for l := range a.queue {
+				a.out.Write(l)
+				a.addPending(-1)
+			}
+		}()
+	}
+
+	if opts.ReportInterval > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			t := time.NewTicker(opts.ReportInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-a.stop:
+					return
+				case <-t.C:
+					a.report()
+				}
+			}
+		}()
+	}
+
+	return a
+}
+
+// Write queues the Log entry.
+//
+// The entry is written synchronously if the output is closed.
+func (a *AsyncOutput) Write(l Log) { a.write(l, a.opts.Overflow) }
+
+// Dropped gets the total number of dropped entries.
+func (a *AsyncOutput) Dropped() uint64 { return atomic.LoadUint64(&a.dropped) }
+
+// Flush waits until all queued entries are written, and flushes the Sink.
+func (a *AsyncOutput) Flush() error {
+	a.pendMu.Lock()
+	for a.pending > 0 {
+		a.done.Wait()
+	}
+	a.pendMu.Unlock()
+	return a.out.Flush()
+}
+
+// Close writes all queued entries, stops the workers, and closes the Sink.
+//
+// The output can still be used after it's closed, but all entries will be
+// written synchronously.
+func (a *AsyncOutput) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.stop)
+	close(a.queue)
+	a.mu.Unlock()
+
+	a.wg.Wait()
+	a.report()
+	return a.out.Close()
+}
+
+func (a *AsyncOutput) write(l Log, overflow int) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.out.Write(l)
+		return
+	}
+
+	if overflow == OverflowDropBelow {
+		overflow = OverflowBlock
+		if severity[l.Level] < severity[a.opts.DropBelow] {
+			overflow = OverflowDropNewest
+		}
+	}
+
+	a.addPending(1)
+	switch overflow {
+	default:
+		a.queue <- l
+	case OverflowDropNewest:
+		select {
+		case a.queue <- l:
+		default:
+			a.drop()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case a.queue <- l:
+				return
+			default:
+			}
+			select {
+			case <-a.queue:
+				a.drop()
+			default:
+			}
+		}
+	}
+}
+
+func (a *AsyncOutput) drop() {
+	atomic.AddUint64(&a.dropped, 1)
+	atomic.AddUint64(&a.unreported, 1)
+	a.addPending(-1)
+}
+
+func (a *AsyncOutput) addPending(n int) {
+	a.pendMu.Lock()
+	a.pending += n
+	if a.pending == 0 {
+		a.done.Broadcast()
+	}
+	a.pendMu.Unlock()
+}
+
+// report logs the number of entries dropped since the last report. This must
+// not be called while Config.mu is held.
+func (a *AsyncOutput) report() {
+	n := atomic.SwapUint64(&a.unreported, 0)
+	if n == 0 {
+		return
+	}
+
+	Config.RunOutputs(Log{
+		Modules: []string{"zlog"},
+		Level:   LevelWarn,
+		Msg:     fmt.Sprintf("async output: dropped %d log entries", n),
+		Data:    F{"dropped": n},
+		Time:    now(),
+	})
+}
+
+// funcSink is a Sink for an OutputFunc.
+type funcSink OutputFunc
+
+func (f funcSink) Write(l Log)  { f(l) }
+func (f funcSink) Flush() error { return nil }
+func (f funcSink) Close() error { return nil }
@@ -0,0 +1,140 @@
+package zlog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncOutput(t *testing.T) {
+	tests := []struct {
+		opts        AsyncOptions
+		in          []Log
+		wantDropped uint64
+		want        []string
+	}{
+		{AsyncOptions{QueueSize: 2, Overflow: OverflowDropNewest},
+			[]Log{{Msg: "1"}, {Msg: "2"}, {Msg: "3"}, {Msg: "4"}},
+			2, []string{"0", "1", "2"}},
+		{AsyncOptions{QueueSize: 2, Overflow: OverflowDropOldest},
+			[]Log{{Msg: "1"}, {Msg: "2"}, {Msg: "3"}, {Msg: "4"}},
+			2, []string{"0", "3", "4"}},
+		{AsyncOptions{QueueSize: 2, Overflow: OverflowDropBelow, DropBelow: LevelWarn},
+			[]Log{{Msg: "1"}, {Msg: "2"}, {Msg: "3"}, {Msg: "4", Level: LevelDbg}},
+			2, []string{"0", "1", "2"}},
+		{AsyncOptions{QueueSize: 2},
+			[]Log{{Msg: "1"}, {Msg: "2"}},
+			0, []string{"0", "1", "2"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				got     []string
+				unblock = make(chan struct{})
+				started = make(chan struct{})
+			)
+			tt.opts.ReportInterval = -1
+			a := NewAsyncOutput(func(l Log) {
+				if l.Msg == "0" {
+					close(started)
+					<-unblock
+				}
+				mu.Lock()
+				got = append(got, l.Msg)
+				mu.Unlock()
+			}, tt.opts)
+
+			// Block the worker on the first entry, so the queue fills up.
+			a.Write(Log{Msg: "0"})
+			<-started
+			for _, l := range tt.in {
+				a.Write(l)
+			}
+			close(unblock)
+
+			if err := a.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if d := a.Dropped(); d != tt.wantDropped {
+				t.Errorf("dropped %d; want %d", d, tt.wantDropped)
+			}
+			mu.Lock()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("\ngot:  %v\nwant: %v", got, tt.want)
+			}
+			mu.Unlock()
+
+			a.Close()
+			a.Write(Log{Msg: "after close"})
+			if got[len(got)-1] != "after close" {
+				t.Errorf("not written after close: %v", got)
+			}
+		})
+	}
+}
+
+func TestAsyncOutputReport(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		got     []Log
+		unblock = make(chan struct{})
+	)
+	// The report is logged to all outputs, not just the wrapped one.
+	defer func(o []OutputFunc) { Config.Outputs = o }(Config.Outputs)
+	Config.Outputs = []OutputFunc{func(l Log) {
+		mu.Lock()
+		got = append(got, l)
+		mu.Unlock()
+	}}
+	a := NewAsyncOutput(func(l Log) {
+		if l.Msg == "block" {
+			<-unblock
+		}
+	}, AsyncOptions{QueueSize: 1, Overflow: OverflowDropNewest, ReportInterval: 10 * time.Millisecond})
+
+	a.Write(Log{Msg: "block"})
+	for i := 0; i < 5; i++ {
+		a.Write(Log{Msg: "x"})
+	}
+	close(unblock)
+	time.Sleep(50 * time.Millisecond)
+	a.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var dropped uint64
+	for _, l := range got {
+		if l.Level == LevelWarn {
+			dropped += l.Data["dropped"].(uint64)
+		}
+	}
+	if dropped != a.Dropped() || dropped == 0 {
+		t.Errorf("reported %d dropped; Dropped() is %d", dropped, a.Dropped())
+	}
+}
+
+func TestAsyncSink(t *testing.T) {
+	s := &testSink{}
+	a := NewAsyncSink(s, AsyncOptions{ReportInterval: -1})
+
+	a.Write(Log{Msg: "1"})
+	a.Write(Log{Msg: "2"})
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	a.Write(Log{Msg: "3"})
+	err := a.Close()
+	if err == nil || err.Error() != "close error" {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	want := "write 1 write 2 flush write 3 close"
+	if out := strings.Join(s.events, " "); out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
@@ -0,0 +1,217 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ECSVersion is the Elastic Common Schema version that FormatECS uses.
+const ECSVersion = "8.11.0"
+
+// FormatECS formats a Log entry as a single-line JSON object with the Elastic
+// Common Schema (ECS) fields:
+//
+//	{"@timestamp":"2020-06-18T13:14:15.000Z","log.level":"info","message":"w00t","ecs.version":"8.11.0"}
+//
+// All keys are written with dots (e.g. "log.level") rather than as nested
+// objects, like the ECS loggers do; Elasticsearch treats them the same.
+//
+// The Modules are written as log.logger, Err as error.message and error.type,
+// the stack from Recover() as error.stack_trace, and the request and trace IDs
+// as http.request.id, trace.id, and span.id.
+//
+// The fields added by FieldsRequest() and HTTPLog() are written as the ECS
+// http.request.*, http.response.*, url.*, client.*, user_agent.original, and
+// event.duration fields; headers without an ECS field are written as
+// http.request.headers.*. The location from FieldsLocation() is written as
+// log.origin.file.*.
+//
+// All other Data fields are written as-is, so you can use ECS names such as
+// "user.id" directly.
+func FormatECS(l Log) string {
+	b := new(bytes.Buffer)
+	b.WriteString(`{"@timestamp":`)
+	b.Write(jsonValue(l.timestamp().UTC().Format("2006-01-02T15:04:05.000Z07:00")))
+	b.WriteString(`,"log.level":`)
+	b.Write(jsonValue(levelNames[l.Level]))
+
+	var (
+		stack string
+		cause error
+	)
+	if l.Err != nil {
+		stack, cause = errorStack(l.Err)
+	}
+
+	msg := l.Msg
+	if msg == "" && cause != nil {
+		msg = cause.Error()
+	}
+	if msg != "" {
+		b.WriteString(`,"message":`)
+		b.Write(jsonValue(msg))
+	}
+	b.WriteString(`,"ecs.version":"` + ECSVersion + `"`)
+
+	if len(l.Modules) > 0 {
+		b.WriteString(`,"log.logger":`)
+		b.Write(jsonValue(strings.Join(l.Modules, ":")))
+	}
+	if cause != nil {
+		b.WriteString(`,"error.message":`)
+		b.Write(jsonValue(cause.Error()))
+		b.WriteString(`,"error.type":`)
+		b.Write(jsonValue(fmt.Sprintf("%T", cause)))
+	}
+	if stack != "" {
+		b.WriteString(`,"error.stack_trace":`)
+		b.Write(jsonValue(stack))
+	}
+	if len(l.Traces) > 0 {
+		b.WriteString(`,"zlog.traces":`)
+		b.Write(jsonValue(l.Traces))
+	}
+
+	f := ecsFields(l.Data)
+	for _, c := range ctxFields(l.Ctx, l.Data) {
+		f[ecsCtxFields[c[0]]] = c[1]
+	}
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		switch k {
+		case "@timestamp", "log.level", "message", "ecs.version", "log.logger",
+			"error.message", "error.type", "error.stack_trace", "zlog.traces":
+			continue // Already written.
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.Write(jsonValue(k))
+		b.WriteByte(':')
+		b.Write(jsonValue(f[k]))
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+// OutputECS writes Log entries as ECS JSON lines; errors are written to stderr
+// and everything else to stdout.
+func OutputECS(l Log) {
+	fmt.Fprintln(stdFile(l), FormatECS(l))
+}
+
+// ECS fields for ctxFields().
+var ecsCtxFields = map[string]string{
+	"request_id": "http.request.id",
+	"trace_id":   "trace.id",
+	"span_id":    "span.id",
+}
+
+// ECS fields for headers; all other headers are written as
+// http.request.headers.*.
+var ecsHeaders = map[string]string{
+	"Content-Length": "http.request.body.bytes",
+	"Content-Type":   "http.request.mime_type",
+	"Referer":        "http.request.referrer",
+	"User-Agent":     "user_agent.original",
+}
+
+// ecsFields maps the fields from FieldsRequest(), HTTPLog(), and
+// FieldsLocation() to ECS fields.
+func ecsFields(data F) F {
+	f := make(F, len(data))
+	for k, v := range data {
+		s, isStr := v.(string)
+		switch {
+		case k == "http_method" && isStr:
+			f["http.request.method"] = s
+		case k == "http_form" && isStr:
+			if s != "" {
+				f["http.request.body.content"] = s
+			}
+		case k == "http_host" && isStr:
+			host, port, err := net.SplitHostPort(s)
+			if err != nil {
+				host = s
+			}
+			f["url.domain"] = host
+			if p, err := strconv.Atoi(port); err == nil {
+				f["url.port"] = p
+			}
+		case k == "http_url" && isStr:
+			f["url.original"] = s
+			if u, err := url.Parse(s); err == nil {
+				f["url.path"] = u.Path
+				if u.RawQuery != "" {
+					f["url.query"] = u.RawQuery
+				}
+				if u.Fragment != "" {
+					f["url.fragment"] = u.Fragment
+				}
+				if u.Scheme != "" {
+					f["url.scheme"] = u.Scheme
+				}
+			}
+		// Header names never have a ".", but ECS names do.
+		case strings.HasPrefix(k, "http.") && strings.IndexByte(k[5:], '.') == -1 && isStr:
+			h := k[5:]
+			e, ok := ecsHeaders[h]
+			if !ok {
+				f["http.request.headers."+strings.ToLower(h)] = s
+				continue
+			}
+			f[e] = s
+			if n, err := strconv.Atoi(s); err == nil && e == "http.request.body.bytes" {
+				f[e] = n
+			}
+
+		case k == "http_remote" && isStr:
+			f["client.address"] = s
+			if host, port, err := net.SplitHostPort(s); err == nil {
+				f["client.ip"] = host
+				if p, err := strconv.Atoi(port); err == nil {
+					f["client.port"] = p
+				}
+			}
+		case k == "http_status":
+			f["http.response.status_code"] = v
+		case k == "http_bytes":
+			f["http.response.body.bytes"] = v
+		case k == "http_duration":
+			if d, ok := v.(time.Duration); ok {
+				f["event.duration"] = int64(d)
+			} else {
+				f[k] = v
+			}
+		case k == "request_id" && isStr:
+			f["http.request.id"] = s
+
+		case k == "location" && isStr:
+			i := strings.LastIndexByte(s, ':')
+			if i == -1 {
+				f[k] = v
+				continue
+			}
+			line, err := strconv.Atoi(s[i+1:])
+			if err != nil {
+				f[k] = v
+				continue
+			}
+			f["log.origin.file.name"] = s[:i]
+			f["log.origin.file.line"] = line
+
+		default:
+			f[k] = v
+		}
+	}
+	return f
+}
@@ -0,0 +1,116 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatECS(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456789, time.UTC)
+	ctx := WithTraceID(WithRequestID(context.Background(), "req1"), "t", "s")
+
+	tests := []struct {
+		in   Log
+		want string
+	}{
+		{Log{Msg: "w00t"},
+			`{"@timestamp":"2020-06-18T13:14:15.123Z","log.level":"info","message":"w00t","ecs.version":"` + ECSVersion + `"}`},
+		{Log{Level: LevelErr, Modules: []string{"a", "b"}, Err: errors.New("oh noes"), Traces: []string{"t1"}},
+			`{"@timestamp":"2020-06-18T13:14:15.123Z","log.level":"error","message":"oh noes","ecs.version":"` + ECSVersion + `",` +
+				`"log.logger":"a:b","error.message":"oh noes","error.type":"*errors.errorString","zlog.traces":["t1"]}`},
+		{Log{Msg: "x", Err: &stackError{err: errors.New("oh noes"), stack: []byte("goroutine 1 [running]:\nmain.main()\n")}},
+			`{"@timestamp":"2020-06-18T13:14:15.123Z","log.level":"info","message":"x","ecs.version":"` + ECSVersion + `",` +
+				`"error.message":"oh noes","error.type":"*errors.errorString","error.stack_trace":"goroutine 1 [running]:\nmain.main()"}`},
+		{Log{Msg: "x", Ctx: ctx, Data: F{"user.id": 42, "request_id": "req1", "message": "ignored", "location": "a.go:12"}},
+			`{"@timestamp":"2020-06-18T13:14:15.123Z","log.level":"info","message":"x","ecs.version":"` + ECSVersion + `",` +
+				`"http.request.id":"req1","log.origin.file.line":12,"log.origin.file.name":"a.go","span.id":"s","trace.id":"t","user.id":42}`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			tt.in.Time = n
+			if out := FormatECS(tt.in); out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatECSRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://example.com:8080/path?q=x", strings.NewReader("a=b"))
+	r.Header.Set("User-Agent", "Firefox")
+	r.Header.Set("Referer", "https://example.net")
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Content-Length", "3")
+	r.Header.Set("X-Custom", "yes")
+	r.ParseForm()
+
+	l := Log{Time: time.Now(), Msg: "x"}.FieldsRequest(r).Fields(F{
+		"http_remote":   "192.0.2.1:1234",
+		"http_status":   200,
+		"http_bytes":    42,
+		"http_duration": 5 * time.Millisecond,
+	})
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(FormatECS(l)), &got); err != nil {
+		t.Fatal(err)
+	}
+	delete(got, "@timestamp")
+
+	want := map[string]interface{}{
+		"log.level":                     "info",
+		"message":                       "x",
+		"ecs.version":                   ECSVersion,
+		"http.request.method":           "POST",
+		"http.request.body.content":     "a=b&q=x",
+		"http.request.body.bytes":       3.0,
+		"http.request.mime_type":        "application/x-www-form-urlencoded",
+		"http.request.referrer":         "https://example.net",
+		"http.request.headers.x-custom": "yes",
+		"http.response.status_code":     200.0,
+		"http.response.body.bytes":      42.0,
+		"user_agent.original":           "Firefox",
+		"url.original":                  "https://example.com:8080/path?q=x",
+		"url.scheme":                    "https",
+		"url.domain":                    "example.com",
+		"url.port":                      8080.0,
+		"url.path":                      "/path",
+		"url.query":                     "q=x",
+		"client.address":                "192.0.2.1:1234",
+		"client.ip":                     "192.0.2.1",
+		"client.port":                   1234.0,
+		"event.duration":                5e6,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestFormatECSRecover(t *testing.T) {
+	var got string
+	Config.SetOutputs(func(l Log) { got = FormatECS(l) })
+	defer Config.SetOutputs(output)
+
+	func() {
+		defer Recover()
+		panic("oh noes")
+	}()
+
+	var l map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l["error.message"] != "oh noes" || l["log.logger"] != "panic" {
+		t.Errorf("wrong error.message or log.logger:\n%s", got)
+	}
+	st, _ := l["error.stack_trace"].(string)
+	if !strings.HasPrefix(st, "goroutine ") || !strings.Contains(st, "TestFormatECSRecover") {
+		t.Errorf("wrong stack trace:\n%s", st)
+	}
+}
@@ -0,0 +1,325 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Rotation intervals for FileOptions.Rotate.
+const (
+	RotateNever = iota
+	RotateHourly
+	RotateDaily
+)
+
+// FileOptions are options for NewFileOutput().
+type FileOptions struct {
+	// Rotate the file when it's larger than this many bytes; 0 means there is
+	// no limit.
+	MaxSize int64
+
+	// Rotate the file on the hour or day boundary (in the local timezone).
+	Rotate int
+
+	// Number of rotated files to keep; the oldest files are removed. 0 means
+	// all files are kept.
+	MaxBackups int
+
+	// Compress rotated files with gzip. This is done in the background, and
+	// errors are written to stderr.
+	Compress bool
+
+	// Format function; the default is the same format as the default output,
+	// without colours and with the full date and time in RFC 3339 format with
+	// milliseconds, rather than Config.FmtTime.
+	Format func(Log) string
+
+	// Permissions for new files; the default is 0644.
+	Mode os.FileMode
+}
+
+// FileOutput writes entries to a file.
+//
+// Rotated files are named path.1, path.2, etc. with path.1 being the most
+// recent one, and with a .gz suffix if Compress is set.
+//
+// The file is re-opened on SIGHUP, for compatibility with logrotate and
+// similar tools. Errors are written to stderr together with the entry.
+type FileOutput struct {
+	mu     sync.Mutex
+	path   string
+	opts   FileOptions
+	fp     *os.File
+	size   int64
+	period time.Time
+	sig    chan os.Signal
+	closed bool
+
+	// Closed when the background compression of the previous rotation is
+	// done; nil if there is none.
+	compressing chan struct{}
+}
+
+var _ Sink = &FileOutput{}
+
+// NewFileOutput opens the file, creating it if it doesn't exist.
+func NewFileOutput(path string, opts FileOptions) (*FileOutput, error) {
+	if opts.Format == nil {
+		opts.Format = func(l Log) string {
+			return formatTextTime(l, false, "2006-01-02T15:04:05.000Z07:00 ")
+		}
+	}
+	if opts.Mode == 0 {
+		opts.Mode = 0644
+	}
+
+	f := &FileOutput{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	sig := make(chan os.Signal, 1)
+	f.sig = sig
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			if err := f.Reopen(); err != nil {
+				fmt.Fprintf(stderr, "zlog: FileOutput: reopen %q: %s\n", f.path, err)
+			}
+		}
+	}()
+	return f, nil
+}
+
+// Write the Log entry to the file.
+func (f *FileOutput) Write(l Log) {
+	line := f.opts.Format(l) + "\n"
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.rotateIfNeeded(int64(len(line)))
+	if err == nil && f.fp == nil {
+		err = os.ErrClosed
+	}
+	if err == nil {
+		var n int
+		n, err = io.WriteString(f.fp, line)
+		f.size += int64(n)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "zlog: FileOutput: writing to %q: %s\n%s", f.path, err, line)
+	}
+}
+
+// Flush commits the file to disk, and waits for the compression of rotated
+// files.
+func (f *FileOutput) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waitCompress()
+	if f.fp == nil {
+		return nil
+	}
+	return f.fp.Sync()
+}
+
+// Close the file.
+func (f *FileOutput) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.waitCompress()
+	if f.sig != nil {
+		signal.Stop(f.sig)
+		close(f.sig)
+		f.sig = nil
+	}
+	if f.fp == nil {
+		return nil
+	}
+	err := f.fp.Close()
+	f.fp = nil
+	return err
+}
+
+// Reopen the file; this is done automatically on SIGHUP.
+func (f *FileOutput) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.fp != nil {
+		f.fp.Close()
+		f.fp = nil
+	}
+	return f.open()
+}
+
+// Rotate the file now.
+func (f *FileOutput) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *FileOutput) open() error {
+	fp, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, f.opts.Mode)
+	if err != nil {
+		return err
+	}
+	st, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+
+	f.fp = fp
+	f.size = st.Size()
+	f.period = f.periodStart(now())
+	if f.size > 0 {
+		f.period = f.periodStart(st.ModTime())
+	}
+	return nil
+}
+
+func (f *FileOutput) periodStart(t time.Time) time.Time {
+	t = t.Local()
+	switch f.opts.Rotate {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+func (f *FileOutput) rotateIfNeeded(n int64) error {
+	if f.fp == nil { // Closed, or a previous rotate or reopen failed.
+		if f.closed {
+			return os.ErrClosed
+		}
+		return f.open()
+	}
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+n > f.opts.MaxSize {
+		return f.rotate()
+	}
+	if f.opts.Rotate != RotateNever && f.size > 0 && !f.periodStart(now()).Equal(f.period) {
+		return f.rotate()
+	}
+	return nil
+}
+
+func (f *FileOutput) rotate() error {
+	if f.fp != nil {
+		f.fp.Close()
+		f.fp = nil
+	}
+	// The backups are renamed below, so wait for the previous rotation.
+	f.waitCompress()
+
+	// Find the number of existing backups.
+	last := 0
+	for {
+		if !exists(f.backup(last+1, false)) && !exists(f.backup(last+1, true)) {
+			break
+		}
+		last++
+	}
+
+	for i := last; i >= 1; i-- {
+		for _, gz := range []bool{false, true} {
+			src := f.backup(i, gz)
+			if !exists(src) {
+				continue
+			}
+			if f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups {
+				if err := os.Remove(src); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.Rename(src, f.backup(i+1, gz)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Rename(f.path, f.backup(1, false)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.opts.Compress {
+		src, dst, done := f.backup(1, false), f.backup(1, true), make(chan struct{})
+		f.compressing = done
+		go func() {
+			defer close(done)
+			if err := compressFile(src, dst, f.opts.Mode); err != nil {
+				fmt.Fprintf(stderr, "zlog: FileOutput: compressing %q: %s\n", src, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// waitCompress waits until the background compression is done.
+func (f *FileOutput) waitCompress() {
+	if f.compressing != nil {
+		<-f.compressing
+		f.compressing = nil
+	}
+}
+
+func (f *FileOutput) backup(n int, gz bool) string {
+	p := f.path + "." + strconv.Itoa(n)
+	if gz {
+		p += ".gz"
+	}
+	return p
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// compressFile writes src to dst with gzip, and removes src.
+func compressFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,222 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	ls, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range ls {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(f.Name(), ".gz") {
+			gz, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err = ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		files[f.Name()] = string(b)
+	}
+	return files
+}
+
+func names(files map[string]string) string {
+	n := make([]string, 0, len(files))
+	for k := range files {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return strings.Join(n, " ")
+}
+
+func TestFileOutputSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileOutput(filepath.Join(dir, "log"), FileOptions{
+		MaxSize:    10,
+		MaxBackups: 2,
+		Format:     func(l Log) string { return l.Msg },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, m := range []string{"1", "2", "3333", "4444444", "5555", "6"} {
+		f.Write(Log{Msg: m})
+	}
+
+	files := readDir(t, dir)
+	if n := names(files); n != "log log.1 log.2" {
+		t.Fatalf("wrong files: %s", n)
+	}
+	if files["log"] != "5555\n6\n" || files["log.1"] != "4444444\n" || files["log.2"] != "1\n2\n3333\n" {
+		t.Errorf("wrong contents: %q", files)
+	}
+}
+
+func TestFileOutputTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.Local)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+
+	f, err := NewFileOutput(filepath.Join(dir, "log"), FileOptions{
+		Rotate:   RotateHourly,
+		Compress: true,
+		Format:   func(l Log) string { return l.Msg },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write(Log{Msg: "a"})
+	n = n.Add(30 * time.Minute)
+	f.Write(Log{Msg: "b"})
+	n = n.Add(30 * time.Minute)
+	f.Write(Log{Msg: "c"})
+	n = n.Add(24 * time.Hour)
+	f.Write(Log{Msg: "d"})
+	if err := f.Flush(); err != nil { // Wait for the compression.
+		t.Fatal(err)
+	}
+
+	files := readDir(t, dir)
+	if n := names(files); n != "log log.1.gz log.2.gz" {
+		t.Fatalf("wrong files: %s", n)
+	}
+	if files["log"] != "d\n" || files["log.1.gz"] != "c\n" || files["log.2.gz"] != "a\nb\n" {
+		t.Errorf("wrong contents: %q", files)
+	}
+}
+
+func TestFileOutputCompressError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	stderr = &buf
+	defer func() { stderr = os.Stderr }()
+
+	path := filepath.Join(dir, "log")
+	f, err := NewFileOutput(path, FileOptions{
+		MaxSize:  2,
+		Compress: true,
+		Format:   func(l Log) string { return l.Msg },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating log.1.gz fails, as it's a symlink to a directory that doesn't
+	// exist.
+	if err := os.Symlink(filepath.Join(dir, "nonexistent", "x"), path+".1.gz"); err != nil {
+		t.Skip(err) // Not supported everywhere, e.g. on Windows.
+	}
+	f.Write(Log{Msg: "a"})
+	f.Write(Log{Msg: "b"})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path + ".1.gz")
+
+	files := readDir(t, dir)
+	if files["log"] != "b\n" || files["log.1"] != "a\n" {
+		t.Errorf("wrong contents: %q", files)
+	}
+	if e := buf.String(); !strings.HasPrefix(e, `zlog: FileOutput: compressing "`+path+`.1": `) ||
+		strings.Count(e, "\n") != 1 {
+		t.Errorf("wrong stderr: %q", e)
+	}
+}
+
+func TestFileOutputReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	stderr = &buf
+	defer func() { stderr = os.Stderr }()
+
+	path := filepath.Join(dir, "log")
+	f, err := NewFileOutput(path, FileOptions{Format: func(l Log) string { return l.Msg }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Write(Log{Msg: "a"})
+	if err := os.Rename(path, path+".old"); err != nil { // Like logrotate.
+		t.Fatal(err)
+	}
+	f.Write(Log{Msg: "b"})
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(Log{Msg: "c"})
+	f.Close()
+	f.Write(Log{Msg: "d"})
+
+	files := readDir(t, dir)
+	if files["log"] != "c\n" || files["log.old"] != "a\nb\n" {
+		t.Errorf("wrong contents: %q", files)
+	}
+	if e := buf.String(); !strings.Contains(e, "file already closed\nd\n") {
+		t.Errorf("wrong stderr: %q", e)
+	}
+}
+
+func TestFileOutputFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewFileOutput(filepath.Join(dir, "log"), FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(Log{Time: time.Date(2020, 6, 18, 13, 14, 15, 123456789, time.UTC),
+		Modules: []string{"a"}, Msg: "w00t", Data: F{"k": "v"}})
+	f.Close()
+
+	want := "2020-06-18T13:14:15.123Z a: INFO: w00t\n\tk = \"v\"\n"
+	if got := readDir(t, dir)["log"]; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,378 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fluent forward protocol modes for FluentOptions.Mode.
+const (
+	FluentPackedForward = iota // Batch of entries as a MessagePack binary.
+	FluentForward              // Batch of entries as a MessagePack array.
+	FluentMessage              // Every entry as a separate message.
+)
+
+// FluentOptions are options for NewFluentOutput().
+type FluentOptions struct {
+	// Network and address to connect to; the network can be "tcp" or "unix".
+	// The default is "tcp" on "127.0.0.1:24224".
+	Network, Addr string
+
+	// Tag for the entries; the modules are appended to this with a ".", so
+	// that Log.Module("db") is sent as "zlog.db". The default is "zlog".
+	Tag string
+
+	// Protocol mode; the default is FluentPackedForward.
+	Mode int
+
+	// Compress entries with gzip; only used with FluentPackedForward.
+	Compress bool
+
+	// Require an ack from the server for every message, so that messages are
+	// resent if the connection drops. Messages may be sent more than once, but
+	// the server can use the chunk ID to remove duplicates.
+	RequireAck bool
+
+	// How long to wait for an ack; the default is 30 seconds.
+	AckTimeout time.Duration
+
+	// Send entries if there are this many; the default is 256. This is always
+	// 1 with FluentMessage.
+	BatchSize int
+
+	// Send entries at least this often; the default is 1 second.
+	FlushInterval time.Duration
+
+	// Maximum number of retries if sending fails; it reconnects before every
+	// retry. The default is 3; set to a negative value to never retry.
+	MaxRetries int
+
+	// Wait time before the second retry, which doubles for every retry up to
+	// MaxBackoff. The defaults are 100ms and 10 seconds.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// FluentOutput sends entries to Fluentd or Fluent Bit with the forward
+// protocol.
+//
+// The record has the keys "level", "msg", "err", "request_id", "trace_id",
+// "span_id", and "traces" if they're set, and all the Data fields. Data fields
+// named "level", "msg", "err", or "traces" are prefixed with "_".
+//
+// Authentication with a shared key isn't supported.
+//
+// Batches are sent in the background; see Sink.
+type FluentOutput struct {
+	opts  FluentOptions
+	batch *batch
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+var _ Sink = &FluentOutput{}
+
+// NewFluentOutput creates a new Fluent output and connects to the server.
+func NewFluentOutput(opts FluentOptions) (*FluentOutput, error) {
+	if opts.Network == "" {
+		opts.Network, opts.Addr = "tcp", "127.0.0.1:24224"
+	}
+	if opts.Tag == "" {
+		opts.Tag = "zlog"
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 30 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.Mode == FluentMessage {
+		opts.BatchSize = 1
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Second
+	}
+
+	f := &FluentOutput{opts: opts}
+	if err := f.connect(); err != nil {
+		return nil, err
+	}
+	f.batch = newBatch("FluentOutput", opts.BatchSize, opts.FlushInterval, f.Send)
+	return f, nil
+}
+
+// Write adds the Log entry to the batch.
+func (f *FluentOutput) Write(l Log) { f.batch.add(l) }
+
+// Flush sends all entries in the batch.
+func (f *FluentOutput) Flush() error { return f.batch.flush() }
+
+// Close sends all entries in the batch and closes the connection.
+//
+// The output can still be used after it's closed, but all entries will be
+// sent right away, and it will reconnect.
+func (f *FluentOutput) Close() error {
+	err := f.batch.close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		if cErr := f.conn.Close(); err == nil {
+			err = cErr
+		}
+		f.conn = nil
+	}
+	return err
+}
+
+type fluentMsg struct {
+	b     []byte
+	chunk string
+}
+
+// Send the Log entries right away, retrying on errors.
+func (f *FluentOutput) Send(ls ...Log) error {
+	if len(ls) == 0 {
+		return nil
+	}
+
+	msgs, err := f.encode(ls)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range msgs {
+		if err := f.sendRetry(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FluentOutput) sendRetry(m fluentMsg) error {
+	var (
+		err     error
+		backoff = f.opts.MinBackoff
+	)
+	for i := 0; i <= f.opts.MaxRetries || i == 0; i++ {
+		if i > 0 {
+			if i > 1 {
+				time.Sleep(backoff)
+				backoff *= 2
+				if backoff > f.opts.MaxBackoff {
+					backoff = f.opts.MaxBackoff
+				}
+			}
+			if err = f.connect(); err != nil {
+				continue
+			}
+		}
+		if err = f.send(m); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (f *FluentOutput) connect() error {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	c, err := net.DialTimeout(f.opts.Network, f.opts.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	f.conn, f.r = c, bufio.NewReader(c)
+	return nil
+}
+
+func (f *FluentOutput) send(m fluentMsg) error {
+	if f.conn == nil {
+		return errNotConnected
+	}
+	if _, err := f.conn.Write(m.b); err != nil {
+		return err
+	}
+	if m.chunk == "" {
+		return nil
+	}
+
+	f.conn.SetReadDeadline(time.Now().Add(f.opts.AckTimeout))
+	defer f.conn.SetReadDeadline(time.Time{})
+	resp, err := mpReadStringMap(f.r)
+	if err != nil {
+		return fmt.Errorf("reading ack: %w", err)
+	}
+	if resp["ack"] != m.chunk {
+		return fmt.Errorf("wrong ack %q; expected %q", resp["ack"], m.chunk)
+	}
+	return nil
+}
+
+// encode the entries as messages for the mode; entries with a different tag
+// are sent as different messages.
+func (f *FluentOutput) encode(ls []Log) ([]fluentMsg, error) {
+	if f.opts.Mode == FluentMessage {
+		msgs := make([]fluentMsg, 0, len(ls))
+		for _, l := range ls {
+			m := fluentMsg{chunk: f.chunk()}
+			m.b = mpArray(m.b, 4)
+			m.b = mpString(m.b, f.tag(l))
+			m.b = mpEventTime(m.b, l.timestamp())
+			m.b = fluentRecord(m.b, l)
+			m.b = f.option(m.b, m.chunk, 0, false)
+			msgs = append(msgs, m)
+		}
+		return msgs, nil
+	}
+
+	var (
+		tags   []string
+		byTag  = make(map[string][]Log)
+		msgs   []fluentMsg
+		packed = f.opts.Mode == FluentPackedForward
+	)
+	for _, l := range ls {
+		t := f.tag(l)
+		if _, ok := byTag[t]; !ok {
+			tags = append(tags, t)
+		}
+		byTag[t] = append(byTag[t], l)
+	}
+	for _, t := range tags {
+		ls := byTag[t]
+
+		var entries []byte
+		if !packed {
+			entries = mpArray(entries, len(ls))
+		}
+		for _, l := range ls {
+			entries = mpArray(entries, 2)
+			entries = mpEventTime(entries, l.timestamp())
+			entries = fluentRecord(entries, l)
+		}
+
+		compress := packed && f.opts.Compress
+		if compress {
+			b := new(bytes.Buffer)
+			w := gzip.NewWriter(b)
+			if _, err := w.Write(entries); err != nil {
+				return nil, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			entries = b.Bytes()
+		}
+
+		m := fluentMsg{chunk: f.chunk()}
+		m.b = mpArray(m.b, 3)
+		m.b = mpString(m.b, t)
+		if packed {
+			m.b = mpBin(m.b, entries)
+		} else {
+			m.b = append(m.b, entries...)
+		}
+		m.b = f.option(m.b, m.chunk, len(ls), compress)
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+func (f *FluentOutput) tag(l Log) string {
+	if len(l.Modules) == 0 {
+		return f.opts.Tag
+	}
+	return f.opts.Tag + "." + strings.Join(l.Modules, ".")
+}
+
+// chunk gets a new chunk ID, if acks are enabled.
+func (f *FluentOutput) chunk() string {
+	if !f.opts.RequireAck {
+		return ""
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// option writes the options map.
+func (f *FluentOutput) option(b []byte, chunk string, size int, compress bool) []byte {
+	n := 0
+	if chunk != "" {
+		n++
+	}
+	if size > 0 {
+		n++
+	}
+	if compress {
+		n++
+	}
+
+	b = mpMap(b, n)
+	if chunk != "" {
+		b = mpString(mpString(b, "chunk"), chunk)
+	}
+	if size > 0 {
+		b = mpInt(mpString(b, "size"), int64(size))
+	}
+	if compress {
+		b = mpString(mpString(b, "compressed"), "gzip")
+	}
+	return b
+}
+
+// fluentRecord writes the record map.
+func fluentRecord(b []byte, l Log) []byte {
+	r := F{"level": levelNames[l.Level]}
+	if l.Msg != "" {
+		r["msg"] = l.Msg
+	}
+	if l.Err != nil {
+		r["err"] = l.Err.Error()
+	}
+	for _, f := range ctxFields(l.Ctx, l.Data) {
+		r[f[0]] = f[1]
+	}
+	if len(l.Traces) > 0 {
+		r["traces"] = l.Traces
+	}
+	for _, k := range sortedKeys(l.Data) {
+		key := k
+		for {
+			_, set := r[key]
+			if !set && key != "level" && key != "msg" && key != "err" && key != "traces" {
+				break
+			}
+			key = "_" + key
+		}
+		r[key] = l.Data[k]
+	}
+
+	b = mpMap(b, len(r))
+	for _, k := range sortedKeys(r) {
+		b = mpValue(mpString(b, k), r[k])
+	}
+	return b
+}
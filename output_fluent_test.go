@@ -0,0 +1,211 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fluentServer accepts connections and sends all decoded messages to the
+// channel; ack is called for every message to decide if it should be acked.
+func fluentServer(t *testing.T, ack func(msg []interface{}) bool) (net.Listener, chan []interface{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan []interface{}, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					v, err := mpDecode(r)
+					if err != nil {
+						return
+					}
+					msg := v.([]interface{})
+					msgs <- msg
+					if ack == nil {
+						continue
+					}
+					if !ack(msg) {
+						return
+					}
+					chunk := msg[len(msg)-1].(map[string]interface{})["chunk"].(string)
+					c.Write(mpString(mpString(mpMap(nil, 1), "ack"), chunk))
+				}
+			}()
+		}
+	}()
+	return ln, msgs
+}
+
+func TestFluentOutput(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123, time.UTC)
+	logs := []Log{
+		{Time: n, Modules: []string{"a", "b"}, Msg: "one", Data: F{"k": "v", "n": 42, "msg": "m", "_msg": "m2", "level": "l"}},
+		{Time: n, Level: LevelErr, Err: errors.New("oh noes"), Traces: []string{"t1"},
+			Ctx: WithRequestID(context.Background(), "req1")},
+		{Time: n, Modules: []string{"a", "b"}, Msg: "two"},
+	}
+	records := []interface{}{
+		map[string]interface{}{"level": "info", "msg": "one", "k": "v", "n": int64(42),
+			"__msg": "m", "_msg": "m2", "_level": "l"},
+		map[string]interface{}{"level": "error", "err": "oh noes", "request_id": "req1", "traces": []interface{}{"t1"}},
+		map[string]interface{}{"level": "info", "msg": "two"},
+	}
+	entry := func(i int) []interface{} { return []interface{}{n, records[i]} }
+
+	recv := func(t *testing.T, msgs chan []interface{}) []interface{} {
+		t.Helper()
+		select {
+		case m := <-msgs:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+			return nil
+		}
+	}
+	decodeEntries := func(t *testing.T, b []byte) []interface{} {
+		t.Helper()
+		var e []interface{}
+		r := bufio.NewReader(bytes.NewReader(b))
+		for {
+			v, err := mpDecode(r)
+			if err != nil {
+				break
+			}
+			e = append(e, v)
+		}
+		return e
+	}
+
+	t.Run("message", func(t *testing.T) {
+		ln, msgs := fluentServer(t, nil)
+		defer ln.Close()
+		f, err := NewFluentOutput(FluentOptions{Addr: ln.Addr().String(), Network: "tcp", Mode: FluentMessage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, l := range logs {
+			f.Write(l)
+		}
+
+		for i, tag := range []string{"zlog.a.b", "zlog", "zlog.a.b"} {
+			want := []interface{}{tag, n, records[i], map[string]interface{}{}}
+			if got := recv(t, msgs); !reflect.DeepEqual(got, want) {
+				t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+			}
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		ln, msgs := fluentServer(t, nil)
+		defer ln.Close()
+		f, err := NewFluentOutput(FluentOptions{Addr: ln.Addr().String(), Network: "tcp", Mode: FluentForward, Tag: "app"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := f.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []interface{}{"app.a.b", []interface{}{entry(0), entry(2)}, map[string]interface{}{"size": int64(2)}}
+		if got := recv(t, msgs); !reflect.DeepEqual(got, want) {
+			t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+		}
+		want = []interface{}{"app", []interface{}{entry(1)}, map[string]interface{}{"size": int64(1)}}
+		if got := recv(t, msgs); !reflect.DeepEqual(got, want) {
+			t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+
+	t.Run("packed forward", func(t *testing.T) {
+		for _, compress := range []bool{false, true} {
+			ln, msgs := fluentServer(t, nil)
+			defer ln.Close()
+			f, err := NewFluentOutput(FluentOptions{Addr: ln.Addr().String(), Network: "tcp", Compress: compress})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := f.Send(logs[0], logs[2]); err != nil {
+				t.Fatal(err)
+			}
+
+			got := recv(t, msgs)
+			b := got[1].([]byte)
+			opt := map[string]interface{}{"size": int64(2)}
+			if compress {
+				opt["compressed"] = "gzip"
+				r, err := gzip.NewReader(bytes.NewReader(b))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ = ioutil.ReadAll(r)
+			}
+			if got[0] != "zlog.a.b" || !reflect.DeepEqual(got[2], opt) {
+				t.Errorf("wrong tag or option: %#v", got)
+			}
+			if e := decodeEntries(t, b); !reflect.DeepEqual(e, []interface{}{entry(0), entry(2)}) {
+				t.Errorf("\ngot:  %#v", e)
+			}
+		}
+	})
+
+	t.Run("ack", func(t *testing.T) {
+		// Close the connection without ack for the first message.
+		var n int32
+		ln, msgs := fluentServer(t, func([]interface{}) bool { return atomic.AddInt32(&n, 1) > 1 })
+		defer ln.Close()
+		f, err := NewFluentOutput(FluentOptions{Addr: ln.Addr().String(), Network: "tcp", RequireAck: true, AckTimeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := f.Send(logs[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		m1, m2 := recv(t, msgs), recv(t, msgs)
+		c1 := m1[2].(map[string]interface{})["chunk"]
+		c2 := m2[2].(map[string]interface{})["chunk"]
+		if c1 == "" || c1 != c2 {
+			t.Errorf("chunk not the same: %q, %q", c1, c2)
+		}
+		if !reflect.DeepEqual(m1, m2) {
+			t.Errorf("different message:\n%#v\n%#v", m1, m2)
+		}
+	})
+
+	t.Run("no ack", func(t *testing.T) {
+		ln, _ := fluentServer(t, func([]interface{}) bool { return false })
+		defer ln.Close()
+		f, err := NewFluentOutput(FluentOptions{Addr: ln.Addr().String(), Network: "tcp", RequireAck: true,
+			MaxRetries: 1, MinBackoff: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := f.Send(logs[0]); err == nil {
+			t.Error("err is nil")
+		}
+	})
+}
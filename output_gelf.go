@@ -0,0 +1,317 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GELF compression for GELFOptions.Compress.
+const (
+	GELFGzip = iota
+	GELFZlib
+	GELFNoCompress
+)
+
+// GELFOptions are options for NewGELFOutput().
+type GELFOptions struct {
+	// Network and address to connect to; the network can be "udp" or "tcp".
+	// The default is "udp" on "127.0.0.1:12201".
+	//
+	// Messages on TCP are framed with a NUL byte, and are never compressed.
+	Network, Addr string
+
+	// Host to send; the default is os.Hostname().
+	Host string
+
+	// Compression for UDP messages larger than ChunkSize; the default is
+	// GELFGzip.
+	Compress int
+
+	// Maximum size of UDP packets; larger messages are compressed, and split
+	// in chunks if they're still too large. The default is 1420, which should
+	// be safe on most networks.
+	ChunkSize int
+}
+
+// GELFOutput sends entries to Graylog, or anything else that accepts GELF 1.1.
+//
+// The short_message is the Err, or the Msg if there is no error (it's sent as
+// _msg if both are set), full_message is the Traces, modules are sent as
+// _modules, and every Data field is sent as an additional field with the key
+// prefixed with "_" and invalid characters replaced with "_". Keys which are
+// reserved ("_id"), used by zlog ("_modules", "_msg", "_request_id", etc.), or
+// which are the same as another key after replacing the characters get "_"
+// appended until they're unique.
+//
+// It will reconnect if sending a message fails; errors are written to stderr
+// together with the entry.
+type GELFOutput struct {
+	mu   sync.Mutex
+	opts GELFOptions
+	conn net.Conn
+}
+
+var _ Sink = &GELFOutput{}
+
+// NewGELFOutput creates a new GELF output and connects to the server.
+func NewGELFOutput(opts GELFOptions) (*GELFOutput, error) {
+	if opts.Network == "" {
+		opts.Network = "udp"
+	}
+	if opts.Addr == "" {
+		opts.Addr = "127.0.0.1:12201"
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = 1420
+	}
+	if opts.Network != "udp" && opts.Network != "tcp" {
+		return nil, fmt.Errorf("zlog.NewGELFOutput: unsupported network %q", opts.Network)
+	}
+
+	g := &GELFOutput{opts: opts}
+	if err := g.connect(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Write the Log entry.
+func (g *GELFOutput) Write(l Log) {
+	if err := g.Send(l); err != nil {
+		fmt.Fprintf(stderr, "zlog: GELFOutput: %s\n%s\n", err, formatText(l, false))
+	}
+}
+
+// Send the Log entries, reconnecting once if sending fails.
+func (g *GELFOutput) Send(ls ...Log) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, l := range ls {
+		var (
+			msgs [][]byte
+			err  error
+		)
+		if g.opts.Network == "tcp" {
+			msgs = [][]byte{append(g.format(l), 0)}
+		} else {
+			msgs, err = g.chunk(g.format(l))
+			if err != nil {
+				return err
+			}
+		}
+
+		err = g.send(msgs)
+		if err != nil {
+			if err := g.connect(); err != nil {
+				return err
+			}
+			err = g.send(msgs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op, as messages aren't buffered.
+func (g *GELFOutput) Flush() error { return nil }
+
+// Close the connection.
+func (g *GELFOutput) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+func (g *GELFOutput) connect() error {
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+	c, err := net.DialTimeout(g.opts.Network, g.opts.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	g.conn = c
+	return nil
+}
+
+func (g *GELFOutput) send(msgs [][]byte) error {
+	if g.conn == nil {
+		return errNotConnected
+	}
+	for _, m := range msgs {
+		if _, err := g.conn.Write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GELF allows at most 128 chunks.
+const gelfMaxChunks = 128
+
+var errGELFTooLarge = errors.New("message too large")
+
+// chunk compresses msg if it's larger than the ChunkSize, and splits it in
+// chunks if it's still too large.
+//
+// Every chunk starts with the magic bytes 0x1e 0x0f, an 8-byte message ID, the
+// sequence number, and the number of chunks.
+func (g *GELFOutput) chunk(msg []byte) ([][]byte, error) {
+	if len(msg) <= g.opts.ChunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	msg, err := gelfCompress(msg, g.opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) <= g.opts.ChunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	size := g.opts.ChunkSize - 12
+	n := (len(msg) + size - 1) / size
+	if n > gelfMaxChunks {
+		return nil, errGELFTooLarge
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		c := make([]byte, 0, 12+end-i*size)
+		c = append(c, 0x1e, 0x0f)
+		c = append(c, id...)
+		c = append(c, byte(i), byte(n))
+		chunks = append(chunks, append(c, msg[i*size:end]...))
+	}
+	return chunks, nil
+}
+
+func gelfCompress(msg []byte, compress int) ([]byte, error) {
+	if compress == GELFNoCompress {
+		return msg, nil
+	}
+
+	b := new(bytes.Buffer)
+	var w io.WriteCloser
+	if compress == GELFZlib {
+		w = zlib.NewWriter(b)
+	} else {
+		w = gzip.NewWriter(b)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (g *GELFOutput) format(l Log) []byte {
+	msg := l.Msg
+	if l.Err != nil {
+		msg = l.Err.Error()
+	}
+	if msg == "" {
+		msg = "-" // short_message can't be empty.
+	}
+	t := l.timestamp()
+
+	b := new(bytes.Buffer)
+	b.WriteString(`{"version":"1.1","host":`)
+	b.Write(jsonValue(g.opts.Host))
+	b.WriteString(`,"short_message":`)
+	b.Write(jsonValue(msg))
+	if len(l.Traces) > 0 {
+		b.WriteString(`,"full_message":`)
+		b.Write(jsonValue(strings.Join(l.Traces, "\n")))
+	}
+	b.WriteString(`,"timestamp":`)
+	b.WriteString(strconv.FormatFloat(float64(t.UnixNano()/1e6)/1e3, 'f', 3, 64))
+	b.WriteString(`,"level":`)
+	b.WriteString(strconv.Itoa(syslogSeverity[l.Level]))
+
+	if len(l.Modules) > 0 {
+		b.WriteString(`,"_modules":`)
+		b.Write(jsonValue(strings.Join(l.Modules, ":")))
+	}
+	if l.Err != nil && l.Msg != "" {
+		b.WriteString(`,"_msg":`)
+		b.Write(jsonValue(l.Msg))
+	}
+	used := map[string]bool{"id": true, "modules": true, "msg": true}
+	for _, f := range ctxFields(l.Ctx, l.Data) {
+		used[f[0]] = true
+		b.WriteString(`,"_` + f[0] + `":`)
+		b.Write(jsonValue(f[1]))
+	}
+	for _, k := range sortedKeys(l.Data) {
+		key := gelfKey(k)
+		for used[key] {
+			key += "_"
+		}
+		used[key] = true
+		b.WriteString(`,"_` + key + `":`)
+		b.Write(gelfValue(l.Data[k]))
+	}
+
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// gelfKey makes a valid GELF field name: only letters, digits, underscores,
+// dashes, and dots are allowed.
+func gelfKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'),
+			r == '_', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+}
+
+// gelfValue writes v as a JSON number or string, as GELF doesn't allow any
+// other types.
+func gelfValue(v interface{}) []byte {
+	switch valueFmt(v) {
+	case "%d", "%f":
+		return jsonValue(v)
+	default:
+		return jsonValue(valueString(v))
+	}
+}
@@ -0,0 +1,194 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFFormat(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456000, time.UTC)
+	tests := []struct {
+		in   Log
+		want string
+	}{
+		{Log{Msg: "w00t"},
+			`{"version":"1.1","host":"host","short_message":"w00t","timestamp":1592486055.123,"level":6}`},
+		{Log{},
+			`{"version":"1.1","host":"host","short_message":"-","timestamp":1592486055.123,"level":6}`},
+		{Log{Level: LevelErr, Modules: []string{"a", "b"}, Msg: "ctx", Err: errors.New("oh noes"),
+			Traces: []string{"t1", "t2"}, Data: F{"k": "v", "n": 42, "f": 1.5, "b": true, "id": "x", "we ird/": []byte("y")}},
+			`{"version":"1.1","host":"host","short_message":"oh noes","full_message":"t1\nt2","timestamp":1592486055.123,"level":3,` +
+				`"_modules":"a:b","_msg":"ctx","_b":"true","_f":1.5,"_id_":"x","_k":"v","_n":42,"_we_ird_":"y"}`},
+		{Log{Msg: "x", Err: errors.New("e"), Modules: []string{"a"}, Ctx: WithTraceID(context.Background(), "t", "s"),
+			Data: F{"msg": "m", "modules": "b", "id": "i0", "id_": "i", "trace id": "t2", "a/b": 1, "a_b": 2}},
+			`{"version":"1.1","host":"host","short_message":"e","timestamp":1592486055.123,"level":6,` +
+				`"_modules":"a","_msg":"x","_trace_id":"t","_span_id":"s",` +
+				`"_a_b":1,"_a_b_":2,"_id_":"i0","_id__":"i","_modules_":"b","_msg_":"m","_trace_id_":"t2"}`},
+		{Log{Level: LevelFatal, Msg: "x", Data: F{"j": JSON(`{"a":1}`), "r": []rune("hi")}},
+			`{"version":"1.1","host":"host","short_message":"x","timestamp":1592486055.123,"level":2,"_j":"{\"a\":1}","_r":"hi"}`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			g := &GELFOutput{opts: GELFOptions{Host: "host"}}
+			tt.in.Time = n
+			if out := string(g.format(tt.in)); out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestGELFOutput(t *testing.T) {
+	t.Run("udp", func(t *testing.T) {
+		for _, c := range []int{GELFGzip, GELFZlib, GELFNoCompress} {
+			t.Run(fmt.Sprintf("%d", c), func(t *testing.T) {
+				pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer pc.Close()
+
+				g, err := NewGELFOutput(GELFOptions{Addr: pc.LocalAddr().String(), Host: "host", Compress: c, ChunkSize: 200})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer g.Close()
+
+				read := func() []byte {
+					t.Helper()
+					pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+					buf := make([]byte, 1024)
+					n, _, err := pc.ReadFrom(buf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					return buf[:n]
+				}
+
+				g.Write(Log{Msg: "w00t"})
+				if got := string(read()); !strings.HasPrefix(got, `{"version":"1.1","host":"host","short_message":"w00t",`) {
+					t.Errorf("wrong message: %q", got)
+				}
+
+				// Use random-ish data so that it's too large even with compression.
+				var big strings.Builder
+				for i := 0; i < 200; i++ {
+					fmt.Fprintf(&big, "%x", time.Now().UnixNano()*int64(i+1)*7919)
+				}
+				g.Write(Log{Msg: big.String()})
+
+				var (
+					msg   []byte
+					id    []byte
+					total = -1
+				)
+				for seen := 0; seen != total; seen++ {
+					chunk := read()
+					if chunk[0] != 0x1e || chunk[1] != 0x0f {
+						t.Fatalf("not a chunk: %q", chunk[:12])
+					}
+					if id == nil {
+						id = chunk[2:10]
+					} else if !bytes.Equal(id, chunk[2:10]) {
+						t.Fatalf("different message ID: %x and %x", id, chunk[2:10])
+					}
+					if int(chunk[10]) != seen {
+						t.Fatalf("wrong sequence number: %d; want %d", chunk[10], seen)
+					}
+					if len(chunk) > 200 {
+						t.Fatalf("chunk too large: %d", len(chunk))
+					}
+					total = int(chunk[11])
+					msg = append(msg, chunk[12:]...)
+				}
+				if total < 2 {
+					t.Fatalf("total = %d", total)
+				}
+
+				var r io.Reader = bytes.NewReader(msg)
+				switch c {
+				case GELFGzip:
+					r, err = gzip.NewReader(r)
+				case GELFZlib:
+					r, err = zlib.NewReader(r)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(got), `"short_message":"`+big.String()+`"`) {
+					t.Errorf("wrong message: %q…", got[:50])
+				}
+			})
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		got := make(chan string, 2)
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			r := bufio.NewReader(c)
+			for {
+				m, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				got <- m
+			}
+		}()
+
+		g, err := NewGELFOutput(GELFOptions{Network: "tcp", Addr: ln.Addr().String(), Host: "host", ChunkSize: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer g.Close()
+
+		big := strings.Repeat("x", 100)
+		g.Write(Log{Msg: "w00t"})
+		g.Write(Log{Msg: big})
+
+		for _, want := range []string{"w00t", big} {
+			select {
+			case m := <-got:
+				if !strings.HasPrefix(m, `{"version":"1.1","host":"host","short_message":"`+want+`",`) || !strings.HasSuffix(m, "}\x00") {
+					t.Errorf("wrong message: %q", m)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout")
+			}
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		g := &GELFOutput{opts: GELFOptions{ChunkSize: 20, Compress: GELFNoCompress}}
+		_, err := g.chunk(make([]byte, 8*200))
+		if err != errGELFTooLarge {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
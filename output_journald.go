@@ -0,0 +1,232 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JournaldOptions are options for NewJournaldOutput().
+type JournaldOptions struct {
+	// Path to the journald socket; the default is
+	// "/run/systemd/journal/socket".
+	Socket string
+
+	// SYSLOG_IDENTIFIER; the default is the program name.
+	Identifier string
+}
+
+// JournaldOutput sends entries to systemd-journald with the native protocol.
+//
+// The fields sent are MESSAGE, PRIORITY, SYSLOG_IDENTIFIER, CODE_FILE,
+// CODE_LINE, CODE_FUNC, ZLOG_MODULES (joined with ":"), ZLOG_TRACE (once for
+// every trace), and every Data field with the key converted to uppercase and
+// invalid characters replaced with "_". Data fields which would be a field
+// with a special meaning in the journal (such as "message" or "code_file") are
+// prefixed with "F_".
+//
+// Entries that are too large for a datagram are written to a temporary file
+// which is passed to journald (this is only supported on Linux). Errors are
+// written to stderr together with the entry.
+//
+// The default output uses this automatically if JOURNAL_STREAM is set to
+// stderr, which systemd does for services, and Config.Format is the default.
+type JournaldOutput struct {
+	mu   sync.Mutex
+	opts JournaldOptions
+	conn *net.UnixConn
+}
+
+var _ Sink = &JournaldOutput{}
+
+// NewJournaldOutput creates a new journald output.
+func NewJournaldOutput(opts JournaldOptions) (*JournaldOutput, error) {
+	if opts.Socket == "" {
+		opts.Socket = "/run/systemd/journal/socket"
+	}
+	if opts.Identifier == "" {
+		opts.Identifier = filepath.Base(os.Args[0])
+	}
+
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: opts.Socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournaldOutput{opts: opts, conn: c}, nil
+}
+
+// Write the Log entry.
+func (j *JournaldOutput) Write(l Log) {
+	if err := j.Send(l); err != nil {
+		fmt.Fprintf(stderr, "zlog: JournaldOutput: %s\n%s\n", err, formatText(l, false))
+	}
+}
+
+// Send the Log entries.
+func (j *JournaldOutput) Send(ls ...Log) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return errNotConnected
+	}
+
+	for _, l := range ls {
+		if err := j.send(j.format(l)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op, as entries aren't buffered.
+func (j *JournaldOutput) Flush() error { return nil }
+
+// Close the connection.
+func (j *JournaldOutput) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+func (j *JournaldOutput) format(l Log) []byte {
+	b := new(bytes.Buffer)
+	msg := l.Msg
+	if l.Err != nil {
+		msg = l.Err.Error()
+	}
+
+	journalField(b, "MESSAGE", msg)
+	journalField(b, "PRIORITY", strconv.Itoa(syslogSeverity[l.Level]))
+	journalField(b, "SYSLOG_IDENTIFIER", j.opts.Identifier)
+	if file, line, fun := callerLocation(); file != "" {
+		journalField(b, "CODE_FILE", file)
+		journalField(b, "CODE_LINE", strconv.Itoa(line))
+		journalField(b, "CODE_FUNC", fun)
+	}
+	if len(l.Modules) > 0 {
+		journalField(b, "ZLOG_MODULES", strings.Join(l.Modules, ":"))
+	}
+	for _, t := range l.Traces {
+		journalField(b, "ZLOG_TRACE", t)
+	}
+	for _, k := range sortedKeys(l.Data) {
+		journalField(b, journalKey(k), valueString(l.Data[k]))
+	}
+	return b.Bytes()
+}
+
+// journalField writes a field; values with a newline are written as the key,
+// a newline, the length as 64-bit little endian integer, and the value.
+func journalField(b *bytes.Buffer, k, v string) {
+	b.WriteString(k)
+	if strings.IndexByte(v, '\n') == -1 {
+		b.WriteByte('=')
+		b.WriteString(v)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(v)))
+	b.WriteString(v)
+	b.WriteByte('\n')
+}
+
+// Journal fields with a special meaning; Data fields with these names (or
+// prefixes) are prefixed with "F_" so they can't override them.
+var (
+	journalReserved = map[string]struct{}{
+		"MESSAGE": {}, "MESSAGE_ID": {}, "PRIORITY": {}, "ERRNO": {},
+		"INVOCATION_ID": {}, "USER_INVOCATION_ID": {}, "TID": {},
+		"UNIT": {}, "USER_UNIT": {}, "DOCUMENTATION": {},
+	}
+	journalReservedPrefix = []string{"CODE_", "SYSLOG_", "ZLOG_", "COREDUMP_", "OBJECT_"}
+)
+
+// journalKey converts k to a valid journal field name: uppercase letters,
+// digits, and underscores, not starting with an underscore or digit, and at
+// most 64 characters. Reserved names are prefixed with "F_".
+func journalKey(k string) string {
+	k = strings.TrimLeft(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, k), "_")
+	if k == "" || (k[0] >= '0' && k[0] <= '9') || journalIsReserved(k) {
+		k = "F_" + k
+	}
+	if len(k) > 64 {
+		k = k[:64]
+	}
+	return k
+}
+
+func journalIsReserved(k string) bool {
+	if _, ok := journalReserved[k]; ok {
+		return true
+	}
+	for _, p := range journalReservedPrefix {
+		if strings.HasPrefix(k, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerLocation gets the location of the first caller outside of zlog (and
+// its subpackages), and the log and log/slog packages.
+func callerLocation() (file string, line int, fun string) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		internal := (strings.HasPrefix(f.Function, "zgo.at/zlog.") || strings.HasPrefix(f.Function, "zgo.at/zlog/")) &&
+			!strings.HasSuffix(f.File, "_test.go")
+		if !internal && !strings.HasPrefix(f.Function, "runtime.") &&
+			!strings.HasPrefix(f.Function, "log.") && !strings.HasPrefix(f.Function, "log/slog.") {
+			return f.File, f.Line, f.Function
+		}
+		if !more {
+			return "", 0, ""
+		}
+	}
+}
+
+var (
+	defaultJournalOnce sync.Once
+	defaultJournal     *JournaldOutput
+)
+
+// journal gets the journald output for the default output, if stderr is
+// connected to the journal.
+func journal() *JournaldOutput {
+	defaultJournalOnce.Do(func() {
+		if !journalStream() {
+			return
+		}
+		j, err := NewJournaldOutput(JournaldOptions{})
+		if err != nil {
+			return
+		}
+		defaultJournal = j
+	})
+	return defaultJournal
+}
@@ -0,0 +1,84 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJournalKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"key", "KEY"},
+		{"http.User-Agent", "HTTP_USER_AGENT"},
+		{"_private", "PRIVATE"},
+		{"1st", "F_1ST"},
+		{"___", "F_"},
+		{"ünïcode", "N_CODE"},
+		{strings.Repeat("a", 70), strings.Repeat("A", 64)},
+		{"message", "F_MESSAGE"},
+		{"priority", "F_PRIORITY"},
+		{"message_id", "F_MESSAGE_ID"},
+		{"code_file", "F_CODE_FILE"},
+		{"syslog_identifier", "F_SYSLOG_IDENTIFIER"},
+		{"zlog.modules", "F_ZLOG_MODULES"},
+		{"messages", "MESSAGES"},
+		{"unit_price", "UNIT_PRICE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := journalKey(tt.in); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournaldFormat(t *testing.T) {
+	j := &JournaldOutput{opts: JournaldOptions{Identifier: "app"}}
+	out := string(j.format(Log{
+		Level:   LevelErr,
+		Modules: []string{"a", "b"},
+		Err:     errors.New("oh\nnoes"),
+		Data:    F{"k": "v", "n": 1, "r": []rune("hi")},
+		Traces:  []string{"t1"},
+	}))
+
+	// CODE_FILE etc. depend on the caller; just check it's this file.
+	if !strings.Contains(out, "CODE_FILE=") || !strings.Contains(out, "output_journald_test.go\n") ||
+		!strings.Contains(out, "CODE_FUNC=zgo.at/zlog.TestJournaldFormat\n") {
+		t.Errorf("no or wrong CODE_ fields:\n%q", out)
+	}
+	i := strings.Index(out, "CODE_FILE=")
+	j2 := strings.Index(out, "ZLOG_MODULES=")
+	out = out[:i] + out[j2:]
+
+	want := "MESSAGE\n\x07\x00\x00\x00\x00\x00\x00\x00oh\nnoes\n" +
+		"PRIORITY=3\nSYSLOG_IDENTIFIER=app\nZLOG_MODULES=a:b\nZLOG_TRACE=t1\nK=v\nN=1\nR=hi\n"
+	if out != want {
+		t.Errorf("\nout:  %q\nwant: %q", out, want)
+	}
+}
+
+func TestJournalField(t *testing.T) {
+	tests := []struct {
+		k, v, want string
+	}{
+		{"K", "v", "K=v\n"},
+		{"K", "", "K=\n"},
+		{"K", "a=b", "K=a=b\n"},
+		{"K", "\n", "K\n\x01\x00\x00\x00\x00\x00\x00\x00\n\n"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			b := new(bytes.Buffer)
+			journalField(b, tt.k, tt.v)
+			if b.String() != tt.want {
+				t.Errorf("\nout:  %q\nwant: %q", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FormatJSON formats a Log entry as a single-line JSON object.
+//
+// The keys are always in the same order: time, level, modules, msg, err,
+// request_id, trace_id, span_id, data, traces. Empty keys (other than time and
+// level) are omitted. The data keys are sorted. The request and trace IDs are
+// read from Log.Ctx.
+//
+// Values of the JSON type are embedded as-is if they're valid JSON, and values
+// that can't be marshalled are written as a string with fmt's %v.
+func FormatJSON(l Log) string {
+	b := new(bytes.Buffer)
+	b.WriteString(`{"time":`)
+	b.Write(jsonValue(l.timestamp().Format(time.RFC3339Nano)))
+	b.WriteString(`,"level":`)
+	b.Write(jsonValue(levelNames[l.Level]))
+
+	if len(l.Modules) > 0 {
+		b.WriteString(`,"modules":`)
+		b.Write(jsonValue(l.Modules))
+	}
+	if l.Msg != "" {
+		b.WriteString(`,"msg":`)
+		b.Write(jsonValue(l.Msg))
+	}
+	if l.Err != nil {
+		b.WriteString(`,"err":`)
+		b.Write(jsonValue(l.Err.Error()))
+	}
+	for _, f := range ctxFields(l.Ctx, nil) {
+		b.WriteString(`,"` + f[0] + `":`)
+		b.Write(jsonValue(f[1]))
+	}
+
+	if len(l.Data) > 0 {
+		keys := make([]string, 0, len(l.Data))
+		for k := range l.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // Map order is random, so be predictable.
+
+		b.WriteString(`,"data":{`)
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(jsonValue(k))
+			b.WriteByte(':')
+			b.Write(jsonValue(l.Data[k]))
+		}
+		b.WriteByte('}')
+	}
+
+	if len(l.Traces) > 0 {
+		b.WriteString(`,"traces":`)
+		b.Write(jsonValue(l.Traces))
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+// OutputJSON writes Log entries as JSON lines; errors are written to stderr and
+// everything else to stdout.
+func OutputJSON(l Log) {
+	fmt.Fprintln(stdFile(l), FormatJSON(l))
+}
+
+// jsonValue marshals v to JSON; this never fails, and will fall back to a
+// string if v can't be marshalled.
+func jsonValue(v interface{}) []byte {
+	switch vv := v.(type) {
+	case JSON:
+		if json.Valid([]byte(vv)) {
+			return []byte(vv)
+		}
+		v = string(vv)
+	case error:
+		v = vv.Error()
+	case []byte:
+		v = string(vv)
+	case []rune:
+		v = string(vv)
+	}
+
+	j, err := jsonMarshal(v)
+	if err != nil {
+		j, _ = jsonMarshal(fmt.Sprintf("%v", v))
+	}
+	return j
+}
+
+// jsonMarshal is like json.Marshal, but without the HTML escaping.
+func jsonMarshal(v interface{}) ([]byte, error) {
+	b := new(bytes.Buffer)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
@@ -0,0 +1,47 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+type badMarshal struct{}
+
+func (badMarshal) MarshalJSON() ([]byte, error) { return nil, errors.New("nope") }
+
+func TestFormatJSON(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		in   Log
+		want string
+	}{
+		{Log{Msg: "w00t"}, `{"time":"2020-06-18T13:14:15Z","level":"info","msg":"w00t"}`},
+		{Log{Level: LevelErr, Err: errors.New("oh noes")},
+			`{"time":"2020-06-18T13:14:15Z","level":"error","err":"oh noes"}`},
+		{Log{Level: LevelDbg, Modules: []string{"a", "b"}, Msg: "<x>"},
+			`{"time":"2020-06-18T13:14:15Z","level":"debug","modules":["a","b"],"msg":"<x>"}`},
+		{Log{Msg: "x", Data: F{"z": 1, "a": "s", "b": []byte("bytes"), "e": errors.New("err")}},
+			`{"time":"2020-06-18T13:14:15Z","level":"info","msg":"x","data":{"a":"s","b":"bytes","e":"err","z":1}}`},
+		{Log{Msg: "x", Data: F{"j": JSON(`{"k": [1, 2]}`), "i": JSON(`{invalid`)}},
+			`{"time":"2020-06-18T13:14:15Z","level":"info","msg":"x","data":{"i":"{invalid","j":{"k": [1, 2]}}}`},
+		{Log{Msg: "x", Data: F{"nan": math.NaN(), "m": badMarshal{}}},
+			`{"time":"2020-06-18T13:14:15Z","level":"info","msg":"x","data":{"m":"{}","nan":"NaN"}}`},
+		{Log{Level: LevelErr, Err: errors.New("e"), Traces: []string{"t1", "t2"}},
+			`{"time":"2020-06-18T13:14:15Z","level":"error","err":"e","traces":["t1","t2"]}`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := FormatJSON(tt.in)
+			if out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", out, tt.want)
+			}
+		})
+	}
+}
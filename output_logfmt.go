@@ -0,0 +1,100 @@
+package zlog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FormatLogfmt formats a Log entry as logfmt:
+//
+//	time=2020-06-18T13:14:15Z level=info module=a:b msg="hello world" k=v
+//
+// The data keys are sorted, and the request and trace IDs from Log.Ctx are
+// added if set. Any traces are written as separate lines before the
+// entry on errors, like the default format.
+func FormatLogfmt(l Log) string {
+	b := &strings.Builder{}
+
+	// Write any existing trace logs on error.
+	if l.Level == LevelErr || l.Level == LevelFatal {
+		for _, t := range l.Traces {
+			b.WriteString(t + "\n")
+		}
+	}
+
+	b.WriteString("time=")
+	b.WriteString(l.timestamp().Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(levelNames[l.Level])
+	if len(l.Modules) > 0 {
+		b.WriteString(" module=")
+		b.WriteString(logfmtQuote(strings.Join(l.Modules, ":")))
+	}
+	if l.Msg != "" {
+		b.WriteString(" msg=")
+		b.WriteString(logfmtQuote(l.Msg))
+	}
+	if l.Err != nil {
+		b.WriteString(" err=")
+		b.WriteString(logfmtQuote(l.Err.Error()))
+	}
+	for _, f := range ctxFields(l.Ctx, l.Data) {
+		b.WriteString(" " + f[0] + "=")
+		b.WriteString(logfmtQuote(f[1]))
+	}
+
+	keys := make([]string, 0, len(l.Data))
+	for k := range l.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // Map order is random, so be predictable.
+	for _, k := range keys {
+		b.WriteByte(' ')
+		b.WriteString(logfmtKey(k))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(l.Data[k]))
+	}
+
+	return b.String()
+}
+
+// OutputLogfmt writes Log entries as logfmt; errors are written to stderr and
+// everything else to stdout.
+func OutputLogfmt(l Log) {
+	fmt.Fprintln(stdFile(l), FormatLogfmt(l))
+}
+
+func logfmtValue(v interface{}) string {
+	return logfmtQuote(valueString(v)) // Only quote strings if needed.
+}
+
+// logfmtQuote quotes s if it's empty or contains spaces, quotes, "=", or
+// unprintable characters.
+func logfmtQuote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, c := range s {
+		if c == ' ' || c == '=' || c == '"' || c == '\\' || !unicode.IsPrint(c) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// logfmtKey replaces characters that aren't allowed in keys with "_".
+func logfmtKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(c rune) rune {
+		if c == ' ' || c == '=' || c == '"' || !unicode.IsPrint(c) {
+			return '_'
+		}
+		return c
+	}, k)
+}
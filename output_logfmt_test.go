@@ -0,0 +1,42 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFormatLogfmt(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		in   Log
+		want string
+	}{
+		{Log{Msg: "w00t"}, `time=2020-06-18T13:14:15Z level=info msg=w00t`},
+		{Log{Msg: "hello world"}, `time=2020-06-18T13:14:15Z level=info msg="hello world"`},
+		{Log{Level: LevelErr, Modules: []string{"a", "b"}, Err: errors.New(`oh "noes"`)},
+			`time=2020-06-18T13:14:15Z level=error module=a:b err="oh \"noes\""`},
+		{Log{Level: LevelDbg, Msg: "x", Data: F{
+			"int": 42, "float": 1.5, "bool": true, "str": "s", "empty": "",
+			"nl": "a\nb", "json": JSON(`{"a":1}`), "b": []byte("x=y"), "r": []rune("hi"),
+			"key with=space": 1, "map": map[string]int{"a": 1},
+		}},
+			`time=2020-06-18T13:14:15Z level=debug msg=x b="x=y" bool=true empty="" float=1.500000 int=42 ` +
+				`json="{\"a\":1}" key_with_space=1 map=map[a:1] nl="a\nb" r=hi str=s`},
+		{Log{Level: LevelErr, Err: errors.New("e"), Traces: []string{"t1", "t2"}},
+			"t1\nt2\ntime=2020-06-18T13:14:15Z level=error err=e"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := FormatLogfmt(tt.in)
+			if out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", out, tt.want)
+			}
+		})
+	}
+}
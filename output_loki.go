@@ -0,0 +1,334 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiOptions are options for NewLokiOutput().
+type LokiOptions struct {
+	// Push API endpoint; the default is
+	// "http://localhost:3100/loki/api/v1/push".
+	Endpoint string
+
+	// Use the JSON encoding instead of snappy-compressed protobuf.
+	JSON bool
+
+	// Tenant ID for multi-tenant Loki, sent as X-Scope-OrgID.
+	TenantID string
+
+	// Additional HTTP headers to send, for example for authentication.
+	Headers http.Header
+
+	// Labels to add to all streams, for example "job" or "app".
+	Labels map[string]string
+
+	// Data keys to use as labels; these are removed from the Data.
+	//
+	// Every combination of labels is a new stream in Loki, so only use keys
+	// with a small number of values.
+	DataLabels []string
+
+	// Format for the log lines; the default is FormatLogfmt.
+	Format func(Log) string
+
+	// Send entries if there are this many; the default is 1024.
+	BatchSize int
+
+	// Send entries at least this often; the default is 1 second.
+	FlushInterval time.Duration
+
+	// Maximum number of retries if Loki returns a 429 or 5xx status, or if
+	// the request fails. The default is 10; set to a negative value to never
+	// retry.
+	MaxRetries int
+
+	// Wait time for the first retry, which doubles for every retry up to
+	// MaxBackoff. The defaults are 500ms and 2 seconds. The Retry-After header
+	// is used if it's sent.
+	MinBackoff, MaxBackoff time.Duration
+
+	// Stop retrying a batch if the next retry would be this long after the
+	// first attempt; the default is 5 seconds.
+	MaxRetryTime time.Duration
+
+	// HTTP client to use; the default is a client with a timeout of 10
+	// seconds.
+	Client *http.Client
+}
+
+// LokiOutput pushes entries to Grafana Loki.
+//
+// Entries are sent in batches, grouped in streams by the labels: "level", the
+// first module as "module" (if any), the Labels, and the DataLabels.
+//
+// Batches are sent in the background; see Sink.
+type LokiOutput struct {
+	opts  LokiOptions
+	batch *batch
+}
+
+var _ Sink = &LokiOutput{}
+
+// NewLokiOutput creates a new Loki output.
+func NewLokiOutput(opts LokiOptions) *LokiOutput {
+	if opts.Endpoint == "" {
+		opts.Endpoint = "http://localhost:3100/loki/api/v1/push"
+	}
+	if opts.Format == nil {
+		opts.Format = FormatLogfmt
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1024
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 10
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 2 * time.Second
+	}
+	if opts.MaxRetryTime <= 0 {
+		opts.MaxRetryTime = 5 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	o := &LokiOutput{opts: opts}
+	o.batch = newBatch("LokiOutput", opts.BatchSize, opts.FlushInterval, o.Send)
+	return o
+}
+
+// Write adds the Log entry to the batch.
+func (o *LokiOutput) Write(l Log) { o.batch.add(l) }
+
+// Flush sends all entries in the batch.
+func (o *LokiOutput) Flush() error { return o.batch.flush() }
+
+// Close sends all entries in the batch and stops the timer.
+//
+// The output can still be used after it's closed, but all entries will be
+// sent right away.
+func (o *LokiOutput) Close() error { return o.batch.close() }
+
+// Send the Log entries right away, retrying on errors.
+func (o *LokiOutput) Send(ls ...Log) error {
+	if len(ls) == 0 {
+		return nil
+	}
+
+	var (
+		body []byte
+		ct   = "application/x-protobuf"
+	)
+	if o.opts.JSON {
+		body, ct = o.encodeJSON(o.streams(ls)), "application/json"
+	} else {
+		body = snappyEncode(o.encodeProto(o.streams(ls)))
+	}
+
+	return retry(o.opts.MaxRetries, o.opts.MinBackoff, o.opts.MaxBackoff, o.opts.MaxRetryTime, func() (bool, time.Duration, error) {
+		return o.post(body, ct)
+	})
+}
+
+// post the body, returning if the request can be retried and how long to wait
+// for it if the server sent a Retry-After header.
+func (o *LokiOutput) post(body []byte, ct string) (bool, time.Duration, error) {
+	req, err := http.NewRequest("POST", o.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	for k, v := range o.opts.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", ct)
+	if o.opts.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", o.opts.TenantID)
+	}
+
+	resp, err := o.opts.Client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, 0, nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false, 0, err
+	}
+
+	return true, retryAfter(resp.Header), err
+}
+
+type (
+	lokiEntry struct {
+		time time.Time
+		line string
+	}
+	lokiStream struct {
+		labels  [][2]string
+		entries []lokiEntry
+	}
+)
+
+// streams groups the entries by their labels.
+func (o *LokiOutput) streams(ls []Log) []lokiStream {
+	var (
+		streams []lokiStream
+		idx     = make(map[string]int)
+	)
+	for _, l := range ls {
+		labels := o.labels(&l)
+		key := lokiLabels(labels)
+		i, ok := idx[key]
+		if !ok {
+			i = len(streams)
+			idx[key] = i
+			streams = append(streams, lokiStream{labels: labels})
+		}
+		streams[i].entries = append(streams[i].entries, lokiEntry{time: l.timestamp(), line: o.opts.Format(l)})
+	}
+	return streams
+}
+
+// labels gets the sorted labels for l, and removes the DataLabels from the
+// Data.
+func (o *LokiOutput) labels(l *Log) [][2]string {
+	labels := make(map[string]string, len(o.opts.Labels)+len(o.opts.DataLabels)+2)
+	for k, v := range o.opts.Labels {
+		labels[lokiLabelName(k)] = v
+	}
+	labels["level"] = levelNames[l.Level]
+	if len(l.Modules) > 0 {
+		labels["module"] = l.Modules[0]
+	}
+
+	var removed bool
+	for _, k := range o.opts.DataLabels {
+		v, ok := l.Data[k]
+		if !ok {
+			continue
+		}
+		if !removed { // Don't modify the caller's map.
+			l.Data, removed = copyFields(l.Data, nil), true
+		}
+		delete(l.Data, k)
+
+		labels[lokiLabelName(k)] = valueString(v)
+	}
+
+	sorted := make([][2]string, 0, len(labels))
+	for k, v := range labels {
+		sorted = append(sorted, [2]string{k, v})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	return sorted
+}
+
+// lokiLabels formats the labels as {k="v", k2="v2"}.
+func lokiLabels(labels [][2]string) string {
+	b := new(strings.Builder)
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(l[0] + "=" + strconv.Quote(l[1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// lokiLabelName makes a valid Prometheus label name: letters, digits, and
+// underscores, not starting with a digit.
+func lokiLabelName(k string) string {
+	k = strings.Map(func(r rune) rune {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'), r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+	if k == "" || (k[0] >= '0' && k[0] <= '9') {
+		k = "_" + k
+	}
+	return k
+}
+
+// encodeProto encodes a PushRequest.
+func (o *LokiOutput) encodeProto(streams []lokiStream) []byte {
+	var b []byte
+	for _, s := range streams {
+		s := s
+		b = pbMessage(b, 1, func(b []byte) []byte { // StreamAdapter
+			b = pbString(b, 1, lokiLabels(s.labels))
+			for _, e := range s.entries {
+				e := e
+				b = pbMessage(b, 2, func(b []byte) []byte { // EntryAdapter
+					b = pbMessage(b, 1, func(b []byte) []byte { // Timestamp
+						b = pbInt(b, 1, e.time.Unix())
+						if ns := e.time.Nanosecond(); ns > 0 {
+							b = pbInt(b, 2, int64(ns))
+						}
+						return b
+					})
+					return pbString(b, 2, e.line)
+				})
+			}
+			return b
+		})
+	}
+	return b
+}
+
+// encodeJSON encodes a push request as JSON.
+func (o *LokiOutput) encodeJSON(streams []lokiStream) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(`{"streams":[`)
+	for i, s := range streams {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"stream":{`)
+		for j, l := range s.labels {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(jsonValue(l[0]))
+			b.WriteByte(':')
+			b.Write(jsonValue(l[1]))
+		}
+		b.WriteString(`},"values":[`)
+		for j, e := range s.entries {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(`["` + strconv.FormatInt(e.time.UnixNano(), 10) + `",`)
+			b.Write(jsonValue(e.line))
+			b.WriteByte(']')
+		}
+		b.WriteString(`]}`)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes()
+}
@@ -0,0 +1,183 @@
+package zlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLokiOutput(t *testing.T) {
+	type req struct {
+		ct, tenant string
+		body       []byte
+	}
+	reqs := make(chan req, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- req{r.Header.Get("Content-Type"), r.Header.Get("X-Scope-OrgID"), b}
+		w.WriteHeader(204)
+	}))
+	defer srv.Close()
+
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	data := F{"user": 42, "path": "/x", "k": "v"}
+	logs := []Log{
+		{Time: n, Modules: []string{"a", "b"}, Msg: "one", Data: data},
+		{Time: n, Level: LevelErr, Msg: "two"},
+		{Time: n.Add(time.Nanosecond), Modules: []string{"a"}, Msg: "three", Data: F{"path": "/x", "k": "v"}},
+	}
+	format := func(l Log) string { return fmt.Sprintf("%s %v", l.Msg, l.Data) }
+
+	t.Run("json", func(t *testing.T) {
+		o := NewLokiOutput(LokiOptions{Endpoint: srv.URL, JSON: true, TenantID: "t1", Format: format,
+			Labels: map[string]string{"app": "test"}, DataLabels: []string{"path", "nonexistent"}})
+		defer o.Close()
+		if err := o.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+
+		r := <-reqs
+		if r.ct != "application/json" || r.tenant != "t1" {
+			t.Errorf("wrong headers: %q %q", r.ct, r.tenant)
+		}
+		want := `{"streams":[` +
+			`{"stream":{"app":"test","level":"info","module":"a","path":"/x"},"values":[` +
+			`["1592486055000000000","one map[k:v user:42]"],["1592486055000000001","three map[k:v]"]]},` +
+			`{"stream":{"app":"test","level":"error"},"values":[["1592486055000000000","two map[]"]]}]}`
+		if string(r.body) != want {
+			t.Errorf("\ngot:  %s\nwant: %s", r.body, want)
+		}
+		if len(data) != 3 {
+			t.Errorf("modified the Data: %v", data)
+		}
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		o := NewLokiOutput(LokiOptions{Endpoint: srv.URL, Format: format})
+		defer o.Close()
+		if err := o.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+
+		r := <-reqs
+		if r.ct != "application/x-protobuf" {
+			t.Errorf("wrong content-type: %q", r.ct)
+		}
+		body, err := snappyDecode(r.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		str := func(v []interface{}) []string {
+			s := make([]string, 0, len(v))
+			for _, vv := range v {
+				s = append(s, string(vv.([]byte)))
+			}
+			return s
+		}
+		if got := str(pbGet(t, body, 1, 1)); !reflect.DeepEqual(got, []string{`{level="info", module="a"}`, `{level="error"}`}) {
+			t.Errorf("labels: %q", got)
+		}
+		if got := str(pbGet(t, body, 1, 2, 2)); !reflect.DeepEqual(got, []string{
+			"one map[k:v path:/x user:42]", "three map[k:v path:/x]", "two map[]",
+		}) {
+			t.Errorf("lines: %q", got)
+		}
+		if got := pbGet(t, body, 1, 2, 1, 1); !reflect.DeepEqual(got, []interface{}{uint64(n.Unix()), uint64(n.Unix()), uint64(n.Unix())}) {
+			t.Errorf("seconds: %v", got)
+		}
+		if got := pbGet(t, body, 1, 2, 1, 2); !reflect.DeepEqual(got, []interface{}{uint64(1)}) {
+			t.Errorf("nanoseconds: %v", got)
+		}
+	})
+}
+
+func TestLokiRetry(t *testing.T) {
+	var (
+		calls  int32
+		status = []int{503, 429, 204, 400}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&calls, 1) - 1
+		w.WriteHeader(status[int(i)%len(status)])
+		w.Write([]byte("oh noes"))
+	}))
+	defer srv.Close()
+
+	o := NewLokiOutput(LokiOptions{Endpoint: srv.URL, MinBackoff: time.Millisecond})
+	defer o.Close()
+
+	if err := o.Send(Log{Msg: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("calls = %d; want 3", c)
+	}
+
+	// 400 isn't retried.
+	err := o.Send(Log{Msg: "x"})
+	if err == nil || err.Error() != "400 Bad Request: oh noes" {
+		t.Errorf("wrong error: %v", err)
+	}
+	if c := atomic.LoadInt32(&calls); c != 4 {
+		t.Errorf("calls = %d; want 4", c)
+	}
+
+	// Give up after MaxRetries.
+	atomic.StoreInt32(&calls, 0)
+	o.opts.MaxRetries = 1
+	err = o.Send(Log{Msg: "x"})
+	if err == nil || err.Error() != "429 Too Many Requests: oh noes" {
+		t.Errorf("wrong error: %v", err)
+	}
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("calls = %d; want 2", c)
+	}
+}
+
+func TestLokiRetryTime(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(503)
+	}))
+	defer srv.Close()
+
+	o := NewLokiOutput(LokiOptions{Endpoint: srv.URL, MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond, MaxRetryTime: 250 * time.Millisecond})
+	defer o.Close()
+
+	start := time.Now()
+	if err := o.Send(Log{Msg: "x"}); err == nil {
+		t.Fatal("err is nil")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("took %s", took)
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("calls = %d; want 3", c)
+	}
+}
+
+func TestLokiLabels(t *testing.T) {
+	got := lokiLabels([][2]string{
+		{lokiLabelName("http.method"), "GET"},
+		{lokiLabelName("1st"), `"q"` + "\n"},
+		{lokiLabelName(""), "ü"},
+	})
+	want := `{http_method="GET", _1st="\"q\"\n", _="ü"}`
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+
+	o := &LokiOutput{opts: LokiOptions{DataLabels: []string{"r", "b", "n"}}}
+	l := Log{Data: F{"r": []rune("hi"), "b": []byte("x"), "n": 1}}
+	if got := o.labels(&l); !reflect.DeepEqual(got, [][2]string{{"b", "x"}, {"level", "info"}, {"n", "1"}, {"r", "hi"}}) {
+		t.Errorf("wrong labels: %q", got)
+	}
+}
@@ -0,0 +1,430 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPOptions are options for NewOTLPOutput().
+type OTLPOptions struct {
+	// Endpoint to POST to; the default is "http://localhost:4318/v1/logs".
+	Endpoint string
+
+	// Use the JSON encoding instead of protobuf.
+	JSON bool
+
+	// Additional HTTP headers to send, for example for authentication.
+	Headers http.Header
+
+	// Resource attributes; service.name is set to the program name if it's
+	// not in here.
+	Resource F
+
+	// Send entries if there are this many; the default is 512.
+	BatchSize int
+
+	// Send entries at least this often; the default is 5 seconds.
+	FlushInterval time.Duration
+
+	// HTTP client to use; the default is a client with a timeout of 10
+	// seconds.
+	Client *http.Client
+}
+
+// OTLPOutput exports entries to an OpenTelemetry collector with OTLP/HTTP.
+//
+// Entries are sent in batches; the Modules are used as the instrumentation
+// scope name (joined with ":"), Data fields as attributes, Err as the
+// exception.message attribute, and the trace and span IDs are read from
+// Log.Ctx. The body is the Msg, or the Err if there is no Msg.
+//
+// Batches are sent in the background; see Sink.
+type OTLPOutput struct {
+	opts  OTLPOptions
+	batch *batch
+}
+
+var _ Sink = &OTLPOutput{}
+
+// NewOTLPOutput creates a new OTLP output.
+func NewOTLPOutput(opts OTLPOptions) *OTLPOutput {
+	if opts.Endpoint == "" {
+		opts.Endpoint = "http://localhost:4318/v1/logs"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if _, ok := opts.Resource["service.name"]; !ok {
+		opts.Resource = copyFields(opts.Resource, F{"service.name": filepath.Base(os.Args[0])})
+	}
+
+	o := &OTLPOutput{opts: opts}
+	o.batch = newBatch("OTLPOutput", opts.BatchSize, opts.FlushInterval, o.Send)
+	return o
+}
+
+// Write adds the Log entry to the batch.
+func (o *OTLPOutput) Write(l Log) { o.batch.add(l) }
+
+// Flush sends all entries in the batch.
+func (o *OTLPOutput) Flush() error { return o.batch.flush() }
+
+// Close sends all entries in the batch and stops the timer.
+//
+// The output can still be used after it's closed, but all entries will be
+// sent right away.
+func (o *OTLPOutput) Close() error { return o.batch.close() }
+
+// Send the Log entries right away.
+func (o *OTLPOutput) Send(ls ...Log) error {
+	if len(ls) == 0 {
+		return nil
+	}
+
+	var (
+		body []byte
+		ct   = "application/x-protobuf"
+	)
+	if o.opts.JSON {
+		body, ct = o.encodeJSON(ls), "application/json"
+	} else {
+		body = o.encodeProto(ls)
+	}
+
+	req, err := http.NewRequest("POST", o.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range o.opts.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", ct)
+
+	resp, err := o.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// OpenTelemetry severity numbers; these are the first of the 4 numbers for
+// every level.
+var otlpSeverity = map[int]int{
+	LevelTrace: 1,
+	LevelDbg:   5,
+	LevelInfo:  9,
+	LevelWarn:  13,
+	LevelErr:   17,
+	LevelFatal: 21,
+}
+
+type (
+	otlpAttr struct {
+		key string
+		val interface{} // string, int64, float64, bool, or []string
+	}
+	otlpRecord struct {
+		time  int64
+		level int
+		body  string
+		attrs []otlpAttr
+		trace []byte
+		span  []byte
+	}
+	otlpScope struct {
+		name    string
+		records []otlpRecord
+	}
+)
+
+// scopes converts the entries to records, grouped by the scope.
+func (o *OTLPOutput) scopes(ls []Log) []otlpScope {
+	var (
+		scopes []otlpScope
+		idx    = make(map[string]int)
+	)
+	for _, l := range ls {
+		name := strings.Join(l.Modules, ":")
+		i, ok := idx[name]
+		if !ok {
+			i = len(scopes)
+			idx[name] = i
+			scopes = append(scopes, otlpScope{name: name})
+		}
+		scopes[i].records = append(scopes[i].records, otlpNewRecord(l))
+	}
+	return scopes
+}
+
+func otlpNewRecord(l Log) otlpRecord {
+	r := otlpRecord{time: l.timestamp().UnixNano(), level: l.Level, body: l.Msg}
+	if l.Err != nil {
+		if r.body == "" {
+			r.body = l.Err.Error()
+		}
+		r.attrs = append(r.attrs, otlpAttr{"exception.message", l.Err.Error()})
+	}
+	if _, ok := l.Data["request_id"]; !ok {
+		if id := RequestID(l.Ctx); id != "" {
+			r.attrs = append(r.attrs, otlpAttr{"request_id", id})
+		}
+	}
+	for _, k := range sortedKeys(l.Data) {
+		r.attrs = append(r.attrs, otlpAttr{k, otlpValue(l.Data[k])})
+	}
+	if len(l.Traces) > 0 {
+		r.attrs = append(r.attrs, otlpAttr{"zlog.traces", l.Traces})
+	}
+
+	trace, span := TraceID(l.Ctx)
+	if t, err := hex.DecodeString(trace); err == nil && len(t) == 16 {
+		r.trace = t
+	}
+	if s, err := hex.DecodeString(span); err == nil && len(s) == 8 {
+		r.span = s
+	}
+	return r
+}
+
+// otlpValue converts v to one of the types we can send as an attribute.
+func otlpValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case int:
+		return int64(vv)
+	case int8:
+		return int64(vv)
+	case int16:
+		return int64(vv)
+	case int32:
+		return int64(vv)
+	case int64:
+		return vv
+	case uint:
+		return otlpValue(uint64(vv))
+	case uint8:
+		return int64(vv)
+	case uint16:
+		return int64(vv)
+	case uint32:
+		return int64(vv)
+	case uint64:
+		if vv > math.MaxInt64 {
+			return strconv.FormatUint(vv, 10)
+		}
+		return int64(vv)
+	case float32:
+		return float64(vv)
+	case float64:
+		return vv
+	case bool:
+		return vv
+	case string:
+		return vv
+	case []byte:
+		return string(vv)
+	case []rune:
+		return string(vv)
+	case JSON:
+		return string(vv)
+	case error:
+		return vv.Error()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func otlpResource(f F) []otlpAttr {
+	attrs := make([]otlpAttr, 0, len(f))
+	for _, k := range sortedKeys(f) {
+		attrs = append(attrs, otlpAttr{k, otlpValue(f[k])})
+	}
+	return attrs
+}
+
+// encodeProto encodes an ExportLogsServiceRequest.
+func (o *OTLPOutput) encodeProto(ls []Log) []byte {
+	return pbMessage(nil, 1, func(b []byte) []byte { // ResourceLogs
+		b = pbMessage(b, 1, func(b []byte) []byte { // Resource
+			for _, a := range otlpResource(o.opts.Resource) {
+				b = pbMessage(b, 1, a.proto)
+			}
+			return b
+		})
+		for _, s := range o.scopes(ls) {
+			s := s
+			b = pbMessage(b, 2, func(b []byte) []byte { // ScopeLogs
+				if s.name != "" {
+					b = pbMessage(b, 1, func(b []byte) []byte { return pbString(b, 1, s.name) })
+				}
+				for _, r := range s.records {
+					b = pbMessage(b, 2, r.proto)
+				}
+				return b
+			})
+		}
+		return b
+	})
+}
+
+// proto encodes a LogRecord.
+func (r otlpRecord) proto(b []byte) []byte {
+	b = pbFixed(b, 1, uint64(r.time))
+	b = pbUint(b, 2, uint64(otlpSeverity[r.level]))
+	b = pbString(b, 3, strings.ToUpper(levelNames[r.level]))
+	if r.body != "" {
+		b = pbMessage(b, 5, func(b []byte) []byte { return otlpProtoValue(b, r.body) })
+	}
+	for _, a := range r.attrs {
+		b = pbMessage(b, 6, a.proto)
+	}
+	if r.trace != nil {
+		b = pbBytesField(b, 9, r.trace)
+	}
+	if r.span != nil {
+		b = pbBytesField(b, 10, r.span)
+	}
+	return b
+}
+
+// proto encodes a KeyValue.
+func (a otlpAttr) proto(b []byte) []byte {
+	b = pbString(b, 1, a.key)
+	return pbMessage(b, 2, func(b []byte) []byte { return otlpProtoValue(b, a.val) })
+}
+
+// otlpProtoValue encodes an AnyValue.
+func otlpProtoValue(b []byte, v interface{}) []byte {
+	switch vv := v.(type) {
+	case string:
+		return pbString(b, 1, vv)
+	case bool:
+		return pbBool(b, 2, vv)
+	case int64:
+		return pbInt(b, 3, vv)
+	case float64:
+		return pbDouble(b, 4, vv)
+	case []string:
+		return pbMessage(b, 5, func(b []byte) []byte { // ArrayValue
+			for _, s := range vv {
+				b = pbMessage(b, 1, func(b []byte) []byte { return pbString(b, 1, s) })
+			}
+			return b
+		})
+	}
+	return b
+}
+
+// encodeJSON encodes an ExportLogsServiceRequest as OTLP/JSON.
+func (o *OTLPOutput) encodeJSON(ls []Log) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(`{"resourceLogs":[{"resource":{"attributes":`)
+	otlpJSONAttrs(b, otlpResource(o.opts.Resource))
+	b.WriteString(`},"scopeLogs":[`)
+	for i, s := range o.scopes(ls) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"scope":{"name":`)
+		b.Write(jsonValue(s.name))
+		b.WriteString(`},"logRecords":[`)
+		for j, r := range s.records {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			r.json(b)
+		}
+		b.WriteString(`]}`)
+	}
+	b.WriteString(`]}]}`)
+	return b.Bytes()
+}
+
+func (r otlpRecord) json(b *bytes.Buffer) {
+	b.WriteString(`{"timeUnixNano":"` + strconv.FormatInt(r.time, 10) + `"`)
+	b.WriteString(`,"severityNumber":` + strconv.Itoa(otlpSeverity[r.level]))
+	b.WriteString(`,"severityText":"` + strings.ToUpper(levelNames[r.level]) + `"`)
+	if r.body != "" {
+		b.WriteString(`,"body":`)
+		otlpJSONValue(b, r.body)
+	}
+	b.WriteString(`,"attributes":`)
+	otlpJSONAttrs(b, r.attrs)
+	if r.trace != nil {
+		b.WriteString(`,"traceId":"` + hex.EncodeToString(r.trace) + `"`)
+	}
+	if r.span != nil {
+		b.WriteString(`,"spanId":"` + hex.EncodeToString(r.span) + `"`)
+	}
+	b.WriteByte('}')
+}
+
+func otlpJSONAttrs(b *bytes.Buffer, attrs []otlpAttr) {
+	b.WriteByte('[')
+	for i, a := range attrs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"key":`)
+		b.Write(jsonValue(a.key))
+		b.WriteString(`,"value":`)
+		otlpJSONValue(b, a.val)
+		b.WriteByte('}')
+	}
+	b.WriteByte(']')
+}
+
+func otlpJSONValue(b *bytes.Buffer, v interface{}) {
+	switch vv := v.(type) {
+	case string:
+		b.WriteString(`{"stringValue":`)
+		b.Write(jsonValue(vv))
+	case bool:
+		b.WriteString(`{"boolValue":` + strconv.FormatBool(vv))
+	case int64:
+		b.WriteString(`{"intValue":"` + strconv.FormatInt(vv, 10) + `"`)
+	case float64:
+		b.WriteString(`{"doubleValue":`)
+		switch {
+		case math.IsNaN(vv):
+			b.WriteString(`"NaN"`)
+		case math.IsInf(vv, 1):
+			b.WriteString(`"Infinity"`)
+		case math.IsInf(vv, -1):
+			b.WriteString(`"-Infinity"`)
+		default:
+			b.WriteString(strconv.FormatFloat(vv, 'g', -1, 64))
+		}
+	case []string:
+		b.WriteString(`{"arrayValue":{"values":[`)
+		for i, s := range vv {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			otlpJSONValue(b, s)
+		}
+		b.WriteString(`]}`)
+	}
+	b.WriteByte('}')
+}
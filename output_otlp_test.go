@@ -0,0 +1,153 @@
+package zlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOTLPOutput(t *testing.T) {
+	type req struct {
+		ct, auth string
+		body     []byte
+	}
+	reqs := make(chan req, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- req{r.Header.Get("Content-Type"), r.Header.Get("Authorization"), b}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(400)
+			w.Write([]byte("bad request\n"))
+		}
+	}))
+	defer srv.Close()
+
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	ctx := WithTraceID(WithRequestID(context.Background(), "req1"),
+		"4bf92f3577b34da6a3ce929d0e0736aa", "00f067aa0ba902b7")
+	logs := []Log{
+		{Time: n, Modules: []string{"a", "b"}, Msg: "w00t", Ctx: ctx, Data: F{"s": "x", "i": 42, "f": 1.5, "b": true}},
+		{Time: n, Level: LevelErr, Err: errors.New("oh noes"), Traces: []string{"t1"}},
+		{Time: n, Level: LevelWarn, Modules: []string{"a", "b"}, Msg: "warn", Ctx: WithTraceID(context.Background(), "invalid", "")},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		o := NewOTLPOutput(OTLPOptions{Endpoint: srv.URL, JSON: true, Resource: F{"service.name": "test"},
+			Headers: http.Header{"Authorization": {"Bearer x"}}})
+		defer o.Close()
+		if err := o.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+
+		r := <-reqs
+		if r.ct != "application/json" || r.auth != "Bearer x" {
+			t.Errorf("wrong headers: %q, %q", r.ct, r.auth)
+		}
+		want := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"test"}}]},"scopeLogs":[` +
+			`{"scope":{"name":"a:b"},"logRecords":[` +
+			`{"timeUnixNano":"1592486055000000000","severityNumber":9,"severityText":"INFO","body":{"stringValue":"w00t"},"attributes":[` +
+			`{"key":"request_id","value":{"stringValue":"req1"}},{"key":"b","value":{"boolValue":true}},{"key":"f","value":{"doubleValue":1.5}},` +
+			`{"key":"i","value":{"intValue":"42"}},{"key":"s","value":{"stringValue":"x"}}],` +
+			`"traceId":"4bf92f3577b34da6a3ce929d0e0736aa","spanId":"00f067aa0ba902b7"},` +
+			`{"timeUnixNano":"1592486055000000000","severityNumber":13,"severityText":"WARN","body":{"stringValue":"warn"},"attributes":[]}]},` +
+			`{"scope":{"name":""},"logRecords":[` +
+			`{"timeUnixNano":"1592486055000000000","severityNumber":17,"severityText":"ERROR","body":{"stringValue":"oh noes"},"attributes":[` +
+			`{"key":"exception.message","value":{"stringValue":"oh noes"}},{"key":"zlog.traces","value":{"arrayValue":{"values":[{"stringValue":"t1"}]}}}]}]}]}]}`
+		if string(r.body) != want {
+			t.Errorf("\ngot:  %s\nwant: %s", r.body, want)
+		}
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		o := NewOTLPOutput(OTLPOptions{Endpoint: srv.URL})
+		defer o.Close()
+		if err := o.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+
+		r := <-reqs
+		if r.ct != "application/x-protobuf" {
+			t.Errorf("wrong content-type: %q", r.ct)
+		}
+
+		str := func(v []interface{}) []string {
+			s := make([]string, 0, len(v))
+			for _, vv := range v {
+				s = append(s, string(vv.([]byte)))
+			}
+			return s
+		}
+		if got := str(pbGet(t, r.body, 1, 1, 1, 1)); !reflect.DeepEqual(got, []string{"service.name"}) {
+			t.Errorf("resource: %q", got)
+		}
+		if got := str(pbGet(t, r.body, 1, 2, 1, 1)); !reflect.DeepEqual(got, []string{"a:b"}) {
+			t.Errorf("scope: %q", got)
+		}
+		if got := pbGet(t, r.body, 1, 2, 2, 1); !reflect.DeepEqual(got, []interface{}{uint64(n.UnixNano()), uint64(n.UnixNano()), uint64(n.UnixNano())}) {
+			t.Errorf("time: %v", got)
+		}
+		if got := pbGet(t, r.body, 1, 2, 2, 2); !reflect.DeepEqual(got, []interface{}{uint64(9), uint64(13), uint64(17)}) {
+			t.Errorf("severity: %v", got)
+		}
+		if got := str(pbGet(t, r.body, 1, 2, 2, 5, 1)); !reflect.DeepEqual(got, []string{"w00t", "warn", "oh noes"}) {
+			t.Errorf("body: %q", got)
+		}
+		if got := str(pbGet(t, r.body, 1, 2, 2, 6, 1)); !reflect.DeepEqual(got, []string{"request_id", "b", "f", "i", "s", "exception.message", "zlog.traces"}) {
+			t.Errorf("attribute keys: %q", got)
+		}
+		if got := pbGet(t, r.body, 1, 2, 2, 6, 2, 3); !reflect.DeepEqual(got, []interface{}{uint64(42)}) {
+			t.Errorf("int attribute: %v", got)
+		}
+		if got := pbGet(t, r.body, 1, 2, 2, 6, 2, 4); !reflect.DeepEqual(got, []interface{}{math.Float64bits(1.5)}) {
+			t.Errorf("double attribute: %v", got)
+		}
+		if got := str(pbGet(t, r.body, 1, 2, 2, 6, 2, 5, 1, 1)); !reflect.DeepEqual(got, []string{"t1"}) {
+			t.Errorf("array attribute: %q", got)
+		}
+		if got := fmt.Sprintf("%x", pbGet(t, r.body, 1, 2, 2, 9)); got != "[4bf92f3577b34da6a3ce929d0e0736aa]" {
+			t.Errorf("trace ID: %s", got)
+		}
+		if got := fmt.Sprintf("%x", pbGet(t, r.body, 1, 2, 2, 10)); got != "[00f067aa0ba902b7]" {
+			t.Errorf("span ID: %s", got)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		o := NewOTLPOutput(OTLPOptions{Endpoint: srv.URL, BatchSize: 2})
+		o.Write(Log{Msg: "1"})
+		select {
+		case <-reqs:
+			t.Fatal("sent before batch is full")
+		default:
+		}
+		o.Write(Log{Msg: "2"})
+		if got := fmt.Sprintf("%s", pbGet(t, (<-reqs).body, 1, 2, 2, 5, 1)); got != "[1 2]" {
+			t.Errorf("wrong batch: %s", got)
+		}
+
+		o.Write(Log{Msg: "3"})
+		if err := o.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%s", pbGet(t, (<-reqs).body, 1, 2, 2, 5, 1)); got != "[3]" {
+			t.Errorf("wrong batch: %s", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		o := NewOTLPOutput(OTLPOptions{Endpoint: srv.URL + "/fail"})
+		defer o.Close()
+		err := o.Send(Log{Msg: "x"})
+		<-reqs
+		if err == nil || err.Error() != "400 Bad Request: bad request" {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
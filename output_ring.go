@@ -0,0 +1,329 @@
+package zlog
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RingOptions are options for NewRingOutput().
+type RingOptions struct {
+	// Maximum number of entries to keep; the default is 1000.
+	MaxEntries int
+
+	// Maximum size of the entries to keep in bytes, as formatted with
+	// FormatJSON(); the default is 1M. The most recent entry is always kept,
+	// even if it's larger than this.
+	MaxBytes int
+}
+
+// RingQuery selects entries for RingOutput.Query().
+type RingQuery struct {
+	// Only entries with one of these levels; all levels if this is empty.
+	Levels []int
+
+	// Only entries with modules matching this pattern, in the same format as
+	// LogConfig.Debug.
+	Module string
+
+	// Only entries logged at or after Since, and before Until.
+	Since, Until time.Time
+
+	// Only the most recent Limit entries; 0 means there is no limit.
+	Limit int
+}
+
+// RingOutput keeps the most recent entries in memory, for example to view the
+// logs on a running server:
+//
+//	ring := zlog.NewRingOutput(zlog.RingOptions{MaxEntries: 5000})
+//	zlog.Config.AppendOutputs(ring.Write)
+//	mux.Handle("/debug/logs", ring)
+//
+// As an http.Handler it shows the entries as text, JSON, or HTML, with the
+// query parameters:
+//
+//	level     Minimum level, e.g. "warn" for warnings, errors, and fatal errors.
+//	module    Module pattern, as RingQuery.Module.
+//	since     Time as RFC 3339 or a duration before now, such as "5m".
+//	until     Time as RFC 3339 or a duration before now.
+//	limit     Maximum number of entries; the default is 500.
+//	format    "text", "json", or "html"; the default is "html" for browsers
+//	          and "text" for everything else.
+//
+// The JSON format is an array with the entries as formatted by FormatJSON().
+//
+// There is no access control, so make sure this isn't publicly accessible.
+type RingOutput struct {
+	mu      sync.RWMutex
+	opts    RingOptions
+	entries []ringEntry
+	start   int // Index of the oldest entry.
+	n       int // Number of entries.
+	size    int // Size of all entries.
+}
+
+type ringEntry struct {
+	l    Log
+	json string
+}
+
+// NewRingOutput creates a new ring buffer output.
+func NewRingOutput(opts RingOptions) *RingOutput {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 1 << 20
+	}
+	return &RingOutput{opts: opts, entries: make([]ringEntry, opts.MaxEntries)}
+}
+
+// Write adds the Log entry, removing the oldest entries if needed.
+func (r *RingOutput) Write(l Log) {
+	l.Time = l.timestamp()
+	e := ringEntry{l: l, json: FormatJSON(l)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.n > 0 && (r.n == len(r.entries) || r.size+len(e.json) > r.opts.MaxBytes) {
+		r.size -= len(r.entries[r.start].json)
+		r.entries[r.start] = ringEntry{}
+		r.start = (r.start + 1) % len(r.entries)
+		r.n--
+	}
+	r.entries[(r.start+r.n)%len(r.entries)] = e
+	r.n++
+	r.size += len(e.json)
+}
+
+// Query gets all entries matching the query, oldest first.
+func (r *RingOutput) Query(q RingQuery) []Log {
+	es := r.query(q)
+	ls := make([]Log, 0, len(es))
+	for _, e := range es {
+		ls = append(ls, e.l)
+	}
+	return ls
+}
+
+func (r *RingOutput) query(q RingQuery) []ringEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Start with the most recent entry for the Limit.
+	var es []ringEntry
+	for i := r.n - 1; i >= 0 && (q.Limit <= 0 || len(es) < q.Limit); i-- {
+		e := r.entries[(r.start+i)%len(r.entries)]
+		if q.match(e.l) {
+			es = append(es, e)
+		}
+	}
+	for i, j := 0, len(es)-1; i < j; i, j = i+1, j-1 {
+		es[i], es[j] = es[j], es[i]
+	}
+	return es
+}
+
+func (q RingQuery) match(l Log) bool {
+	if len(q.Levels) > 0 {
+		found := false
+		for _, lvl := range q.Levels {
+			if l.Level == lvl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Module != "" && !matchModule(q.Module, splitModules(strings.Join(l.Modules, ":"))) {
+		return false
+	}
+	if !q.Since.IsZero() && l.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !l.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// ServeHTTP shows the entries.
+func (r *RingOutput) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	q, err := parseRingQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	es := r.query(q)
+
+	format := req.FormValue("format")
+	if format == "" {
+		format = "text"
+		if strings.Contains(req.Header.Get("Accept"), "text/html") {
+			format = "html"
+		}
+	}
+
+	switch format {
+	default:
+		http.Error(w, fmt.Sprintf("unknown format: %q", format), http.StatusBadRequest)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, e := range es {
+			fmt.Fprintln(w, formatText(e.l, false))
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		for i, e := range es {
+			if i > 0 {
+				w.Write([]byte(",\n"))
+			}
+			w.Write([]byte(e.json))
+		}
+		w.Write([]byte("]\n"))
+	case "html":
+		rows := make([]ringRow, 0, len(es))
+		for _, e := range es {
+			rows = append(rows, newRingRow(e.l))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := ringTemplate.Execute(w, struct {
+			Level, Module, Since, Until, Limit string
+			Levels                             []string
+			Rows                               []ringRow
+		}{req.FormValue("level"), req.FormValue("module"), req.FormValue("since"),
+			req.FormValue("until"), req.FormValue("limit"),
+			[]string{"trace", "debug", "info", "warn", "error", "fatal"}, rows})
+		if err != nil {
+			fmt.Fprintf(stderr, "zlog: RingOutput: %s\n", err)
+		}
+	}
+}
+
+func parseRingQuery(req *http.Request) (RingQuery, error) {
+	q := RingQuery{Module: req.FormValue("module"), Limit: 500}
+
+	if lvl := req.FormValue("level"); lvl != "" {
+		min, err := parseLevel(lvl)
+		if err != nil {
+			return q, err
+		}
+		for l, s := range severity {
+			if s >= severity[min] {
+				q.Levels = append(q.Levels, l)
+			}
+		}
+	}
+
+	var err error
+	if q.Since, err = parseRingTime(req.FormValue("since")); err != nil {
+		return q, fmt.Errorf("invalid since: %w", err)
+	}
+	if q.Until, err = parseRingTime(req.FormValue("until")); err != nil {
+		return q, fmt.Errorf("invalid until: %w", err)
+	}
+
+	if l := req.FormValue("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
+		if err != nil {
+			return q, fmt.Errorf("invalid limit: %w", err)
+		}
+	}
+	return q, nil
+}
+
+// parseRingTime parses a time as RFC 3339 or as a duration before now.
+func parseRingTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+type ringRow struct {
+	Time, Level, Modules, Msg, Err string
+	Fields, Traces                 []string
+}
+
+func newRingRow(l Log) ringRow {
+	row := ringRow{
+		Time:    l.Time.Format("2006-01-02 15:04:05.000"),
+		Level:   levelNames[l.Level],
+		Modules: strings.Join(l.Modules, ":"),
+		Msg:     l.Msg,
+		Traces:  l.Traces,
+	}
+	if l.Err != nil {
+		row.Err = l.Err.Error()
+	}
+	for _, f := range ctxFields(l.Ctx, l.Data) {
+		row.Fields = append(row.Fields, f[0]+"="+f[1])
+	}
+	for _, k := range sortedKeys(l.Data) {
+		row.Fields = append(row.Fields, fmt.Sprintf("%s="+valueFmt(l.Data[k]), k, l.Data[k]))
+	}
+	return row
+}
+
+var ringTemplate = template.Must(template.New("ring").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Logs</title>
+	<style>
+		body       { font: 14px sans-serif; margin: 1em; }
+		form       { margin-bottom: 1em; }
+		table      { border-collapse: collapse; width: 100%; }
+		th, td     { text-align: left; vertical-align: top; padding: .2em .5em; border-bottom: 1px solid #ddd; }
+		td         { font-family: monospace; white-space: pre-wrap; }
+		.nowrap    { white-space: nowrap; }
+		.fields    { color: #555; }
+		.warn      { background-color: #fff8e0; }
+		.error     { background-color: #ffe8e8; }
+		.fatal     { background-color: #ffd0d0; }
+		.debug, .trace { color: #777; }
+	</style>
+</head>
+<body>
+	<form>
+		<label>Level <select name="level">
+			<option value="">all</option>
+			{{range .Levels}}<option{{if eq . $.Level}} selected{{end}}>{{.}}</option>{{end}}
+		</select></label>
+		<label>Module <input name="module" value="{{.Module}}" placeholder="api:**"></label>
+		<label>Since <input name="since" value="{{.Since}}" placeholder="5m"></label>
+		<label>Until <input name="until" value="{{.Until}}"></label>
+		<label>Limit <input name="limit" value="{{.Limit}}" placeholder="500" size="5"></label>
+		<button>Filter</button>
+	</form>
+
+	<table>
+		<thead><tr><th>Time</th><th>Level</th><th>Module</th><th>Message</th></tr></thead>
+		<tbody>
+		{{range .Rows}}<tr class="{{.Level}}">
+			<td class="nowrap">{{.Time}}</td>
+			<td>{{.Level}}</td>
+			<td>{{.Modules}}</td>
+			<td>{{.Msg}}{{if and .Msg .Err}}: {{end}}{{.Err}}
+				{{- if .Fields}}<div class="fields">{{range .Fields}}{{.}} {{end}}</div>{{end}}
+				{{- range .Traces}}<div class="fields">{{.}}</div>{{end}}</td>
+		</tr>
+		{{else}}<tr><td colspan="4">No entries</td></tr>
+		{{end}}
+		</tbody>
+	</table>
+</body>
+</html>
+`))
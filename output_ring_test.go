@@ -0,0 +1,165 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ringMsgs(ls []Log) []string {
+	m := make([]string, 0, len(ls))
+	for _, l := range ls {
+		m = append(m, l.Msg)
+	}
+	return m
+}
+
+func TestRingOutput(t *testing.T) {
+	t.Run("max entries", func(t *testing.T) {
+		r := NewRingOutput(RingOptions{MaxEntries: 3})
+		for i := 0; i < 5; i++ {
+			r.Write(Log{Msg: fmt.Sprintf("%d", i)})
+		}
+		if got := ringMsgs(r.Query(RingQuery{})); !reflect.DeepEqual(got, []string{"2", "3", "4"}) {
+			t.Errorf("wrong entries: %q", got)
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+		size := len(FormatJSON(Log{Time: n, Msg: "0"}))
+
+		r := NewRingOutput(RingOptions{MaxBytes: size * 2})
+		for i := 0; i < 5; i++ {
+			r.Write(Log{Time: n, Msg: fmt.Sprintf("%d", i)})
+		}
+		if got := ringMsgs(r.Query(RingQuery{})); !reflect.DeepEqual(got, []string{"3", "4"}) {
+			t.Errorf("wrong entries: %q", got)
+		}
+
+		// Always keep the last entry.
+		r.Write(Log{Time: n, Msg: strings.Repeat("x", size*3)})
+		if got := r.Query(RingQuery{}); len(got) != 1 || r.size != len(FormatJSON(got[0])) {
+			t.Errorf("wrong entries: %d (size %d)", len(got), r.size)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+		r := NewRingOutput(RingOptions{})
+		r.Write(Log{Time: n, Msg: "a", Level: LevelDbg, Modules: []string{"api"}})
+		r.Write(Log{Time: n.Add(time.Second), Msg: "b", Level: LevelErr, Modules: []string{"api", "auth"}})
+		r.Write(Log{Time: n.Add(2 * time.Second), Msg: "c", Level: LevelInfo, Modules: []string{"db"}})
+		r.Write(Log{Time: n.Add(3 * time.Second), Msg: "d", Level: LevelErr})
+		r.Write(Log{Time: n.Add(4 * time.Second), Msg: "e", Level: LevelInfo, Modules: []string{"api:auth"}})
+
+		tests := []struct {
+			q    RingQuery
+			want []string
+		}{
+			{RingQuery{}, []string{"a", "b", "c", "d", "e"}},
+			{RingQuery{Levels: []int{LevelErr}}, []string{"b", "d"}},
+			{RingQuery{Levels: []int{LevelDbg, LevelInfo}}, []string{"a", "c", "e"}},
+			{RingQuery{Module: "api"}, []string{"a", "b", "e"}},
+			{RingQuery{Module: "api:*"}, []string{"b", "e"}},
+			{RingQuery{Module: "api:auth"}, []string{"b", "e"}},
+			{RingQuery{Since: n.Add(time.Second)}, []string{"b", "c", "d", "e"}},
+			{RingQuery{Until: n.Add(time.Second)}, []string{"a"}},
+			{RingQuery{Since: n.Add(time.Second), Until: n.Add(3 * time.Second)}, []string{"b", "c"}},
+			{RingQuery{Limit: 2}, []string{"d", "e"}},
+			{RingQuery{Limit: 1, Levels: []int{LevelErr}, Module: "api"}, []string{"b"}},
+			{RingQuery{Levels: []int{LevelFatal}}, []string{}},
+		}
+		for i, tt := range tests {
+			t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+				if got := ringMsgs(r.Query(tt.q)); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("\ngot:  %q\nwant: %q", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestRingOutputHTTP(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	now = func() time.Time { return n.Add(time.Minute) }
+	defer func() { now = time.Now }()
+
+	r := NewRingOutput(RingOptions{})
+	r.Write(Log{Time: n, Msg: "a", Level: LevelDbg, Modules: []string{"api"}})
+	r.Write(Log{Time: n.Add(time.Second), Msg: "<b>", Level: LevelErr, Err: errors.New("oh noes"),
+		Modules: []string{"api", "auth"}, Data: F{"k": "v"}})
+	r.Write(Log{Time: n.Add(40 * time.Second), Msg: "c", Level: LevelWarn})
+
+	get := func(t *testing.T, url, accept string) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		b, _ := ioutil.ReadAll(rr.Body)
+		return rr.Code, rr.Header().Get("Content-Type"), string(b)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		code, ct, body := get(t, "/debug/logs?level=warn", "")
+		if code != 200 || ct != "text/plain; charset=utf-8" {
+			t.Fatalf("%d %q", code, ct)
+		}
+		want := formatText(r.Query(RingQuery{})[1], false) + "\n" + formatText(r.Query(RingQuery{})[2], false) + "\n"
+		if body != want {
+			t.Errorf("\ngot:  %q\nwant: %q", body, want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		code, ct, body := get(t, "/debug/logs?format=json&module=api&since=2020-06-18T13:14:15Z&until=30s", "")
+		if code != 200 || ct != "application/json" {
+			t.Fatalf("%d %q", code, ct)
+		}
+		var got []map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatalf("%s\n%s", err, body)
+		}
+		if len(got) != 2 || got[0]["msg"] != "a" || got[1]["msg"] != "<b>" || got[1]["data"].(map[string]interface{})["k"] != "v" {
+			t.Errorf("wrong entries:\n%s", body)
+		}
+
+		_, _, body = get(t, "/debug/logs?format=json&module=nothing", "")
+		if body != "[]\n" {
+			t.Errorf("wrong body: %q", body)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		code, ct, body := get(t, "/debug/logs?level=error&limit=10", "text/html,application/xhtml+xml")
+		if code != 200 || ct != "text/html; charset=utf-8" {
+			t.Fatalf("%d %q", code, ct)
+		}
+		for _, s := range []string{`<tr class="error">`, `&lt;b&gt;: oh noes`, `k=&#34;v&#34;`,
+			`<option selected>error</option>`, `value="10"`} {
+			if !strings.Contains(body, s) {
+				t.Errorf("%q not in body:\n%s", s, body)
+			}
+		}
+		if strings.Contains(body, `<tr class="warn">`) || strings.Contains(body, "<b>") {
+			t.Errorf("wrong body:\n%s", body)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, u := range []string{"?level=x", "?since=x", "?until=x", "?limit=x", "?format=x"} {
+			if code, _, _ := get(t, "/debug/logs"+u, ""); code != 400 {
+				t.Errorf("%s: %d", u, code)
+			}
+		}
+	})
+}
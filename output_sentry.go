@@ -0,0 +1,404 @@
+package zlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SentryOptions are options for NewSentryOutput().
+type SentryOptions struct {
+	// Sentry DSN, as "https://key@sentry.example.com/42".
+	DSN string
+
+	// Write envelopes to this directory instead of sending them, as
+	// "<event_id>.envelope"; the DSN is optional if this is set. This is useful
+	// for tests, or to send them later with sentry-cli.
+	Dir string
+
+	// Environment and release to send; these are optional.
+	Environment, Release string
+
+	// Server name to send; the default is os.Hostname().
+	ServerName string
+
+	// HTTP client to use; the default is a client with a timeout of 10
+	// seconds.
+	Client *http.Client
+}
+
+// SentryOutput sends LevelErr and LevelFatal entries to Sentry as events; all
+// other entries are ignored, so you want to use this together with another
+// output.
+//
+// The Err is sent as the exception, with the stack frames if it's from
+// Recover(), and the Msg as the message. The Traces are sent as breadcrumbs,
+// the Data fields as extras, and the modules and request ID as tags; the trace
+// and span ID are sent as the trace context.
+//
+// Events are sent in the background at least every second; see Sink.
+type SentryOutput struct {
+	opts     SentryOptions
+	endpoint string
+	auth     string
+	batch    *batch
+}
+
+var _ Sink = &SentryOutput{}
+
+// NewSentryOutput creates a new Sentry output.
+func NewSentryOutput(opts SentryOptions) (*SentryOutput, error) {
+	if opts.ServerName == "" {
+		opts.ServerName, _ = os.Hostname()
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	s := &SentryOutput{opts: opts}
+	if opts.DSN == "" && opts.Dir == "" {
+		return nil, fmt.Errorf("zlog.NewSentryOutput: need either DSN or Dir")
+	}
+	if opts.DSN != "" {
+		var err error
+		s.endpoint, s.auth, err = sentryParseDSN(opts.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("zlog.NewSentryOutput: %w", err)
+		}
+	}
+	s.batch = newBatch("SentryOutput", 16, time.Second, s.Send)
+	return s, nil
+}
+
+// sentryParseDSN gets the envelope endpoint and X-Sentry-Auth header from a
+// DSN.
+func sentryParseDSN(dsn string) (endpoint, auth string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("invalid DSN %q: scheme must be http or https", dsn)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid DSN %q: no public key", dsn)
+	}
+
+	p := strings.TrimRight(u.Path, "/")
+	i := strings.LastIndexByte(p, '/')
+	project := p[i+1:]
+	if _, err := strconv.ParseUint(project, 10, 64); err != nil {
+		return "", "", fmt.Errorf("invalid DSN %q: invalid project ID %q", dsn, project)
+	}
+
+	endpoint = u.Scheme + "://" + u.Host + p[:i] + "/api/" + project + "/envelope/"
+	auth = "Sentry sentry_version=7, sentry_client=zlog, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return endpoint, auth, nil
+}
+
+// Write adds the Log entry to the batch if it's an error.
+func (s *SentryOutput) Write(l Log) {
+	if l.Level == LevelErr || l.Level == LevelFatal {
+		s.batch.add(l)
+	}
+}
+
+// Flush sends all events in the batch.
+func (s *SentryOutput) Flush() error { return s.batch.flush() }
+
+// Close sends all events in the batch and stops the timer.
+//
+// The output can still be used after it's closed, but all events will be sent
+// right away.
+func (s *SentryOutput) Close() error { return s.batch.close() }
+
+// Send the Log entries which are errors as events right away.
+func (s *SentryOutput) Send(ls ...Log) error {
+	for _, l := range ls {
+		if l.Level != LevelErr && l.Level != LevelFatal {
+			continue
+		}
+
+		id, env, err := s.envelope(l)
+		if err != nil {
+			return err
+		}
+		if s.opts.Dir != "" {
+			err = ioutil.WriteFile(filepath.Join(s.opts.Dir, id+".envelope"), env, 0666)
+		} else {
+			err = s.post(env)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SentryOutput) post(env []byte) error {
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(env))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	r, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	b, _ := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if r.StatusCode >= 300 {
+		var e struct {
+			Detail string `json:"detail"`
+		}
+		msg := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &e) == nil && e.Detail != "" {
+			msg = e.Detail
+		}
+		return fmt.Errorf("%s: %s", r.Status, msg)
+	}
+	return nil
+}
+
+type (
+	sentryEvent struct {
+		EventID     string                     `json:"event_id"`
+		Timestamp   string                     `json:"timestamp"`
+		Platform    string                     `json:"platform"`
+		Level       string                     `json:"level"`
+		Logger      string                     `json:"logger,omitempty"`
+		ServerName  string                     `json:"server_name,omitempty"`
+		Environment string                     `json:"environment,omitempty"`
+		Release     string                     `json:"release,omitempty"`
+		Message     *sentryMessage             `json:"message,omitempty"`
+		Exception   *sentryValues              `json:"exception,omitempty"`
+		Breadcrumbs *sentryValues              `json:"breadcrumbs,omitempty"`
+		Tags        map[string]string          `json:"tags,omitempty"`
+		Extra       map[string]json.RawMessage `json:"extra,omitempty"`
+		Contexts    map[string]interface{}     `json:"contexts,omitempty"`
+	}
+	sentryMessage struct {
+		Formatted string `json:"formatted"`
+	}
+	sentryValues struct {
+		Values interface{} `json:"values"`
+	}
+	sentryException struct {
+		Type       string            `json:"type"`
+		Value      string            `json:"value"`
+		Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+	}
+	sentryStacktrace struct {
+		Frames []sentryFrame `json:"frames"`
+	}
+	sentryFrame struct {
+		Function string `json:"function"`
+		Module   string `json:"module,omitempty"`
+		AbsPath  string `json:"abs_path,omitempty"`
+		Filename string `json:"filename,omitempty"`
+		Lineno   int    `json:"lineno,omitempty"`
+		InApp    bool   `json:"in_app"`
+	}
+	sentryBreadcrumb struct {
+		Timestamp string `json:"timestamp"`
+		Category  string `json:"category"`
+		Message   string `json:"message"`
+	}
+	sentryTrace struct {
+		TraceID string `json:"trace_id"`
+		SpanID  string `json:"span_id,omitempty"`
+	}
+)
+
+const sentryTime = "2006-01-02T15:04:05.000000Z"
+
+// envelope creates an envelope with one event.
+func (s *SentryOutput) envelope(l Log) (string, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	e := s.event(hex.EncodeToString(id), l)
+
+	event, err := jsonMarshal(e)
+	if err != nil {
+		return "", nil, err
+	}
+	head, err := jsonMarshal(struct {
+		EventID string `json:"event_id"`
+		SentAt  string `json:"sent_at"`
+		DSN     string `json:"dsn,omitempty"`
+	}{e.EventID, time.Now().UTC().Format(sentryTime), s.opts.DSN})
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := new(bytes.Buffer)
+	b.Write(head)
+	fmt.Fprintf(b, "\n{\"type\":\"event\",\"length\":%d}\n", len(event))
+	b.Write(event)
+	b.WriteByte('\n')
+	return e.EventID, b.Bytes(), nil
+}
+
+func (s *SentryOutput) event(id string, l Log) sentryEvent {
+	e := sentryEvent{
+		EventID:     id,
+		Timestamp:   l.timestamp().UTC().Format(sentryTime),
+		Platform:    "go",
+		Level:       levelNames[l.Level],
+		Logger:      strings.Join(l.Modules, ":"),
+		ServerName:  s.opts.ServerName,
+		Environment: s.opts.Environment,
+		Release:     s.opts.Release,
+	}
+
+	if l.Msg != "" {
+		e.Message = &sentryMessage{Formatted: l.Msg}
+	}
+	if l.Err != nil {
+		stack, cause := errorStack(l.Err)
+		ex := sentryException{Type: fmt.Sprintf("%T", cause), Value: cause.Error()}
+		if frames := sentryFrames(stack); len(frames) > 0 {
+			ex.Stacktrace = &sentryStacktrace{Frames: frames}
+		}
+		e.Exception = &sentryValues{Values: []sentryException{ex}}
+	}
+
+	if len(l.Traces) > 0 {
+		// Traces don't have a time; use the entry's time, which keeps the
+		// order as Sentry sorts them by time.
+		bc := make([]sentryBreadcrumb, 0, len(l.Traces))
+		for _, t := range l.Traces {
+			bc = append(bc, sentryBreadcrumb{Timestamp: e.Timestamp, Category: "trace", Message: t})
+		}
+		e.Breadcrumbs = &sentryValues{Values: bc}
+	}
+
+	if len(l.Modules) > 0 {
+		e.Tags = map[string]string{"module": e.Logger}
+	}
+	var trace sentryTrace
+	for _, f := range ctxFields(l.Ctx, nil) {
+		switch f[0] {
+		case "request_id":
+			if e.Tags == nil {
+				e.Tags = make(map[string]string)
+			}
+			e.Tags[f[0]] = f[1]
+		case "trace_id":
+			trace.TraceID = f[1]
+		case "span_id":
+			trace.SpanID = f[1]
+		}
+	}
+	if trace.TraceID != "" {
+		e.Contexts = map[string]interface{}{"trace": trace}
+	}
+
+	if len(l.Data) > 0 {
+		e.Extra = make(map[string]json.RawMessage, len(l.Data))
+		for k, v := range l.Data {
+			e.Extra[k] = jsonValue(v)
+		}
+	}
+	return e
+}
+
+// sentryFrames parses the stack from debug.Stack(), which looks like:
+//
+//	goroutine 1 [running]:
+//	runtime/debug.Stack()
+//		/usr/lib/go/src/runtime/debug/stack.go:24 +0x5e
+//	main.(*T).M.func1()
+//		/src/main.go:6 +0x18
+//	panic({0x559718?, 0x4a4918?})
+//		/usr/lib/go/src/runtime/panic.go:859 +0x125
+//	main.main()
+//		/src/main.go:7 +0x25
+//
+// Frames are returned with the outermost call first, as Sentry expects. The
+// frames up to and including the panic are removed, as they're from Recover()
+// and not interesting.
+func sentryFrames(stack string) []sentryFrame {
+	if stack == "" {
+		return nil
+	}
+
+	var (
+		lines  = strings.Split(stack, "\n")
+		frames []sentryFrame
+	)
+	for i := 0; i < len(lines)-1; i++ {
+		fn, loc := lines[i], lines[i+1]
+		if !strings.HasPrefix(loc, "\t") || strings.HasPrefix(fn, "\t") {
+			continue
+		}
+		i++
+
+		// Remove the arguments, or " in goroutine 1" from "created by [..]".
+		if strings.HasPrefix(fn, "created by ") {
+			fn = strings.TrimPrefix(fn, "created by ")
+			if j := strings.Index(fn, " in goroutine "); j > -1 {
+				fn = fn[:j]
+			}
+		} else if j := strings.LastIndexByte(fn, '('); j > 0 && strings.HasSuffix(fn, ")") {
+			fn = fn[:j]
+		}
+
+		// Remove the " +0x25" offset.
+		loc = strings.TrimSpace(loc)
+		if j := strings.LastIndex(loc, " +0x"); j > -1 {
+			loc = loc[:j]
+		}
+		f := sentryFrame{Function: fn, AbsPath: loc}
+		if j := strings.LastIndexByte(loc, ':'); j > -1 {
+			f.AbsPath = loc[:j]
+			f.Lineno, _ = strconv.Atoi(loc[j+1:])
+		}
+		f.Filename = filepath.Base(f.AbsPath)
+
+		// The package is everything up to the first "." after the last "/":
+		// "zgo.at/zlog.Recover", "main.(*T).M.func1".
+		slash := strings.LastIndexByte(fn, '/') + 1
+		if j := strings.IndexByte(fn[slash:], '.'); j > -1 {
+			f.Module, f.Function = fn[:slash+j], fn[slash+j+1:]
+		}
+
+		// Assume that packages without a "." in the first path element are
+		// from the standard library.
+		first := f.Module
+		if j := strings.IndexByte(first, '/'); j > -1 {
+			first = first[:j]
+		}
+		f.InApp = f.Module == "main" || strings.Contains(first, ".")
+
+		if f.Module == "" && f.Function == "panic" {
+			frames = frames[:0]
+			continue
+		}
+		frames = append(frames, f)
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
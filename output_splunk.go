@@ -0,0 +1,356 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SplunkOptions are options for NewSplunkOutput().
+type SplunkOptions struct {
+	// Base URL of the HTTP Event Collector; the default is
+	// "https://localhost:8088".
+	Endpoint string
+
+	// HEC token.
+	Token string
+
+	// Metadata for the events; the defaults are os.Hostname(), the program
+	// name, and "_json". The default for Index is the token's default index.
+	Host, Source, SourceType, Index string
+
+	// Don't compress the requests with gzip.
+	DisableCompression bool
+
+	// Channel for indexer acknowledgement; this must be a GUID. If set, the
+	// acknowledgements are checked in the background every AckInterval, and
+	// entries which aren't indexed after AckTimeout are written to stderr. The
+	// defaults are 1 second and 1 minute.
+	Channel                 string
+	AckInterval, AckTimeout time.Duration
+
+	// Send entries if there are this many; the default is 512.
+	BatchSize int
+
+	// Send entries at least this often; the default is 5 seconds.
+	FlushInterval time.Duration
+
+	// Maximum number of retries if the HEC is busy (503), or if the request
+	// fails. The default is 10; set to a negative value to never retry.
+	MaxRetries int
+
+	// Wait time for the first retry, which doubles for every retry up to
+	// MaxBackoff. The defaults are 500ms and 2 seconds. The Retry-After header
+	// is used if it's sent.
+	MinBackoff, MaxBackoff time.Duration
+
+	// Stop retrying a batch if the next retry would be this long after the
+	// first attempt; the default is 5 seconds.
+	MaxRetryTime time.Duration
+
+	// HTTP client to use; the default is a client with a timeout of 10
+	// seconds.
+	Client *http.Client
+}
+
+// SplunkOutput sends entries to the Splunk HTTP Event Collector (HEC).
+//
+// The event is a JSON object with the level, modules, msg, err, request and
+// trace IDs, and traces; the Data fields are sent as indexed fields.
+//
+// Batches are sent in the background; see Sink.
+type SplunkOutput struct {
+	opts  SplunkOptions
+	batch *batch
+
+	mu       sync.Mutex
+	acks     map[int64]splunkAck // Waiting for the acknowledgement.
+	checking bool                // checkAcks() is running.
+	wg       sync.WaitGroup
+}
+
+type splunkAck struct {
+	ls  []Log
+	end time.Time
+}
+
+var _ Sink = &SplunkOutput{}
+
+// NewSplunkOutput creates a new Splunk HEC output.
+func NewSplunkOutput(opts SplunkOptions) *SplunkOutput {
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://localhost:8088"
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.Source == "" {
+		opts.Source = filepath.Base(os.Args[0])
+	}
+	if opts.SourceType == "" {
+		opts.SourceType = "_json"
+	}
+	if opts.AckInterval <= 0 {
+		opts.AckInterval = time.Second
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 10
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 2 * time.Second
+	}
+	if opts.MaxRetryTime <= 0 {
+		opts.MaxRetryTime = 5 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	s := &SplunkOutput{opts: opts, acks: make(map[int64]splunkAck)}
+	s.batch = newBatch("SplunkOutput", opts.BatchSize, opts.FlushInterval, s.Send)
+	return s
+}
+
+// Write adds the Log entry to the batch.
+func (s *SplunkOutput) Write(l Log) { s.batch.add(l) }
+
+// Flush sends all entries in the batch.
+func (s *SplunkOutput) Flush() error { return s.batch.flush() }
+
+// Close sends all entries in the batch and stops the timer. If Channel is set
+// it also waits for the acknowledgements, up to AckTimeout.
+//
+// The output can still be used after it's closed, but all entries will be
+// sent right away.
+func (s *SplunkOutput) Close() error {
+	err := s.batch.close()
+	s.wg.Wait()
+	return err
+}
+
+// Send the Log entries right away, retrying if the HEC is busy.
+//
+// If Channel is set this doesn't wait for the acknowledgement, which is
+// checked in the background.
+func (s *SplunkOutput) Send(ls ...Log) error {
+	if len(ls) == 0 {
+		return nil
+	}
+
+	body := new(bytes.Buffer)
+	for _, l := range ls {
+		s.format(body, l)
+	}
+
+	if !s.opts.DisableCompression {
+		b := new(bytes.Buffer)
+		w := gzip.NewWriter(b)
+		if _, err := body.WriteTo(w); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = b
+	}
+
+	var resp splunkResponse
+	err := retry(s.opts.MaxRetries, s.opts.MinBackoff, s.opts.MaxBackoff, s.opts.MaxRetryTime, func() (bool, time.Duration, error) {
+		return s.post("/services/collector/event", body.Bytes(), !s.opts.DisableCompression, &resp)
+	})
+	if err != nil || s.opts.Channel == "" {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acks[resp.AckID] = splunkAck{ls: ls, end: time.Now().Add(s.opts.AckTimeout)}
+	if !s.checking {
+		s.checking = true
+		s.wg.Add(1)
+		go s.checkAcks()
+	}
+	return nil
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID int64  `json:"ackId"`
+}
+
+// post to the HEC, returning if the request can be retried.
+func (s *SplunkOutput) post(path string, body []byte, gzipped bool, resp interface{}) (bool, time.Duration, error) {
+	req, err := http.NewRequest("POST", s.opts.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.opts.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.opts.Channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", s.opts.Channel)
+	}
+
+	r, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return true, 0, err
+	}
+	if r.StatusCode >= 300 {
+		var e splunkResponse
+		msg := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &e) == nil && e.Text != "" {
+			msg = e.Text
+		}
+		return r.StatusCode == http.StatusServiceUnavailable, retryAfter(r.Header),
+			fmt.Errorf("%s: %s", r.Status, msg)
+	}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return false, 0, fmt.Errorf("reading response: %w", err)
+	}
+	return false, 0, nil
+}
+
+// checkAcks checks the acknowledgements every AckInterval, until there are no
+// more to check. Entries which aren't acknowledged after AckTimeout are written
+// to stderr.
+func (s *SplunkOutput) checkAcks() {
+	defer s.wg.Done()
+	var lastErr error
+	for {
+		time.Sleep(s.opts.AckInterval)
+
+		s.mu.Lock()
+		ids := make([]string, 0, len(s.acks))
+		for id := range s.acks {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		s.mu.Unlock()
+		sort.Strings(ids)
+
+		// Don't retry here; it's checked again after AckInterval.
+		var resp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		_, _, err := s.post("/services/collector/ack", []byte(`{"acks":[`+strings.Join(ids, ",")+`]}`), false, &resp)
+		if err != nil {
+			lastErr = err
+		}
+
+		var failed []splunkAck
+		s.mu.Lock()
+		for id, a := range s.acks {
+			if resp.Acks[strconv.FormatInt(id, 10)] {
+				delete(s.acks, id)
+			} else if time.Now().After(a.end) {
+				delete(s.acks, id)
+				failed = append(failed, a)
+			}
+		}
+		done := len(s.acks) == 0
+		if done {
+			s.checking = false
+		}
+		s.mu.Unlock()
+
+		for _, a := range failed {
+			msg := "no ack after " + s.opts.AckTimeout.String()
+			if lastErr != nil {
+				msg += "; last error checking ack: " + lastErr.Error()
+			}
+			fmt.Fprintf(stderr, "zlog: SplunkOutput: %s\n", msg)
+			for _, l := range a.ls {
+				fmt.Fprintln(stderr, formatText(l, false))
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func (s *SplunkOutput) format(b *bytes.Buffer, l Log) {
+	b.WriteString(`{"time":`)
+	b.WriteString(strconv.FormatFloat(float64(l.timestamp().UnixNano()/1e6)/1e3, 'f', 3, 64))
+	b.WriteString(`,"host":`)
+	b.Write(jsonValue(s.opts.Host))
+	b.WriteString(`,"source":`)
+	b.Write(jsonValue(s.opts.Source))
+	b.WriteString(`,"sourcetype":`)
+	b.Write(jsonValue(s.opts.SourceType))
+	if s.opts.Index != "" {
+		b.WriteString(`,"index":`)
+		b.Write(jsonValue(s.opts.Index))
+	}
+
+	b.WriteString(`,"event":{"level":`)
+	b.Write(jsonValue(levelNames[l.Level]))
+	if len(l.Modules) > 0 {
+		b.WriteString(`,"modules":`)
+		b.Write(jsonValue(l.Modules))
+	}
+	if l.Msg != "" {
+		b.WriteString(`,"msg":`)
+		b.Write(jsonValue(l.Msg))
+	}
+	if l.Err != nil {
+		b.WriteString(`,"err":`)
+		b.Write(jsonValue(l.Err.Error()))
+	}
+	for _, f := range ctxFields(l.Ctx, nil) {
+		b.WriteString(`,"` + f[0] + `":`)
+		b.Write(jsonValue(f[1]))
+	}
+	if len(l.Traces) > 0 {
+		b.WriteString(`,"traces":`)
+		b.Write(jsonValue(l.Traces))
+	}
+	b.WriteByte('}')
+
+	// Indexed fields can only be strings.
+	if len(l.Data) > 0 {
+		b.WriteString(`,"fields":{`)
+		for i, k := range sortedKeys(l.Data) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(jsonValue(k))
+			b.WriteByte(':')
+			b.Write(jsonValue(valueString(l.Data[k])))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString("}\n")
+}
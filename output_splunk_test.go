@@ -0,0 +1,206 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplunkOutput(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456000, time.UTC)
+	logs := []Log{
+		{Time: n, Modules: []string{"a", "b"}, Msg: "w00t", Data: F{"k": "v", "n": 42}},
+		{Time: n, Level: LevelErr, Err: errors.New("oh noes"), Traces: []string{"t1"},
+			Ctx: WithTraceID(context.Background(), "t", "s")},
+	}
+	want := `{"time":1592486055.123,"host":"host","source":"app","sourcetype":"_json","index":"idx",` +
+		`"event":{"level":"info","modules":["a","b"],"msg":"w00t"},"fields":{"k":"v","n":"42"}}` + "\n" +
+		`{"time":1592486055.123,"host":"host","source":"app","sourcetype":"_json","index":"idx",` +
+		`"event":{"level":"error","err":"oh noes","trace_id":"t","span_id":"s","traces":["t1"]}}` + "\n"
+
+	var (
+		mu       sync.Mutex
+		events   []string
+		acks     int
+		statuses []int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Splunk token" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"text":"Invalid authorization","code":3}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/services/collector/event":
+			if len(statuses) > 0 {
+				s := statuses[0]
+				statuses = statuses[1:]
+				w.WriteHeader(s)
+				w.Write([]byte(`{"text":"Server is busy","code":9}`))
+				return
+			}
+			var body io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				var err error
+				body, err = gzip.NewReader(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+			b, _ := ioutil.ReadAll(body)
+			events = append(events, string(b))
+			if r.Header.Get("X-Splunk-Request-Channel") != "" {
+				w.Write([]byte(`{"text":"Success","code":0,"ackId":7}`))
+			} else {
+				w.Write([]byte(`{"text":"Success","code":0}`))
+			}
+		case "/services/collector/ack":
+			b, _ := ioutil.ReadAll(r.Body)
+			if string(b) != `{"acks":[7]}` {
+				t.Errorf("wrong ack request: %s", b)
+			}
+			acks++
+			if acks < 3 {
+				w.Write([]byte(`{"acks":{"7":false}}`))
+			} else {
+				w.Write([]byte(`{"acks":{"7":true}}`))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	get := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		e := events
+		events = nil
+		return e
+	}
+	opts := func(o SplunkOptions) SplunkOptions {
+		o.Endpoint, o.Host, o.Source, o.Index = srv.URL+"/", "host", "app", "idx"
+		if o.Token == "" {
+			o.Token = "token"
+		}
+		return o
+	}
+
+	t.Run("send", func(t *testing.T) {
+		for _, disable := range []bool{false, true} {
+			s := NewSplunkOutput(opts(SplunkOptions{DisableCompression: disable}))
+			defer s.Close()
+			if err := s.Send(logs...); err != nil {
+				t.Fatal(err)
+			}
+			if e := get(); len(e) != 1 || e[0] != want {
+				t.Errorf("\ngot:  %q\nwant: %q", e, want)
+			}
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		s := NewSplunkOutput(opts(SplunkOptions{BatchSize: 2}))
+		s.Write(logs[0])
+		if e := get(); len(e) != 0 {
+			t.Errorf("sent before batch is full: %q", e)
+		}
+		s.Write(logs[1])
+		var e []string
+		for i := 0; i < 500 && len(e) == 0; i++ { // Sent in the background.
+			time.Sleep(time.Millisecond)
+			e = get()
+		}
+		if len(e) != 1 || e[0] != want {
+			t.Errorf("\ngot:  %q\nwant: %q", e, want)
+		}
+		s.Write(logs[0])
+		s.Close()
+		if e := get(); len(e) != 1 {
+			t.Errorf("not sent on close: %q", e)
+		}
+	})
+
+	t.Run("ack", func(t *testing.T) {
+		s := NewSplunkOutput(opts(SplunkOptions{Channel: "FE0ECFAD-13D5-401B-847D-77833BD77131",
+			AckInterval: time.Millisecond}))
+		if err := s.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+		if e := get(); len(e) != 1 {
+			t.Errorf("not sent: %q", e)
+		}
+		s.Close() // Waits for the acks.
+		mu.Lock()
+		defer mu.Unlock()
+		if acks != 3 {
+			t.Errorf("acks = %d", acks)
+		}
+	})
+
+	t.Run("ack timeout", func(t *testing.T) {
+		mu.Lock()
+		acks = -100
+		mu.Unlock()
+		buf := new(bytes.Buffer)
+		stderr = buf
+		defer func() { stderr = os.Stderr }()
+
+		s := NewSplunkOutput(opts(SplunkOptions{Channel: "FE0ECFAD-13D5-401B-847D-77833BD77131",
+			AckInterval: time.Millisecond, AckTimeout: 10 * time.Millisecond}))
+		if err := s.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		out := buf.String()
+		if !strings.HasPrefix(out, "zlog: SplunkOutput: no ack after 10ms\n") || !strings.Contains(out, "w00t") {
+			t.Errorf("wrong output:\n%s", out)
+		}
+		get()
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		mu.Lock()
+		statuses = []int{503, 503}
+		mu.Unlock()
+
+		s := NewSplunkOutput(opts(SplunkOptions{MinBackoff: time.Millisecond}))
+		defer s.Close()
+		if err := s.Send(logs...); err != nil {
+			t.Fatal(err)
+		}
+		if e := get(); len(e) != 1 {
+			t.Errorf("not sent: %q", e)
+		}
+
+		mu.Lock()
+		statuses = []int{503, 503}
+		mu.Unlock()
+		s.opts.MaxRetries = 1
+		err := s.Send(logs...)
+		if err == nil || err.Error() != "503 Service Unavailable: Server is busy" {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		s := NewSplunkOutput(opts(SplunkOptions{Token: "wrong"}))
+		defer s.Close()
+		err := s.Send(logs...)
+		if err == nil || err.Error() != "401 Unauthorized: Invalid authorization" {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
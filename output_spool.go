@@ -0,0 +1,660 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpoolOptions are options for NewSpoolOutput().
+type SpoolOptions struct {
+	// Maximum size of all segments in bytes; if this is exceeded the oldest
+	// segment with the lowest level is removed. The default is 100M.
+	MaxSize int64
+
+	// Start a new segment if the current one is larger than this many bytes;
+	// the default is 1M.
+	SegmentSize int64
+
+	// Send at most this many entries at a time; the default is 256.
+	BatchSize int
+
+	// Send entries if there are BatchSize entries, or at least this often; the
+	// default is 1 second.
+	FlushInterval time.Duration
+
+	// Maximum wait time if sending fails; the wait time starts at
+	// FlushInterval and doubles for every failure. The default is 1 minute.
+	MaxBackoff time.Duration
+}
+
+// SpoolOutput writes entries to segment files in a directory before they're
+// sent, so that entries aren't lost if the destination can't be reached. This
+// can be used with the Send() method of all the network outputs:
+//
+//	loki := zlog.NewLokiOutput(zlog.LokiOptions{Endpoint: "http://loki:3100/loki/api/v1/push"})
+//	s, err := zlog.NewSpoolOutput("/var/spool/myapp", loki.Send, zlog.SpoolOptions{})
+//	if err != nil {
+//	    panic(err)
+//	}
+//	zlog.Config.AppendSinks(s)
+//	defer zlog.Shutdown(context.Background())
+//
+// Entries are sent from a background goroutine, in the order they were
+// written. If sending fails the entries are kept and it will try again later.
+// Entries that weren't sent when the program stops are sent the next time
+// NewSpoolOutput() is used with the same directory.
+//
+// Every level has its own segment files, so that the segments with the lowest
+// level can be removed first if the spool becomes larger than MaxSize; the
+// number of removed entries is logged (to the spool) as a warning.
+//
+// The Data fields are stored as JSON, so they may have a different type when
+// they're sent: for example numbers are sent as int64 or float64, and maps and
+// structs as JSON. Files aren't synced, so entries may be lost if the system
+// crashes (but not if the program crashes).
+type SpoolOutput struct {
+	dropped    uint64 // Accessed atomically; keep first for alignment.
+	unreported uint64
+
+	dir  string
+	send func(...Log) error
+	opts SpoolOptions
+
+	sendMu sync.Mutex // Only one send at a time.
+
+	mu      sync.Mutex
+	segs    [][]*spoolSegment // By severity; oldest first.
+	size    int64             // Size of all segments.
+	seq     uint64            // Last written sequence number.
+	sent    uint64            // Last sent sequence number.
+	written int               // Entries written since the last kick.
+	closed  bool
+
+	kick chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// spoolSegment is a file with JSON lines for one level.
+type spoolSegment struct {
+	path string
+	size int64
+	fp   *os.File // Open for writing; nil if it's full.
+	n    int      // Unsent entries in the file.
+	sent int      // Entries sent since it was opened.
+
+	read int64        // Bytes read in to buf.
+	buf  []spoolEntry // Entries read but not yet sent.
+}
+
+var _ Sink = &SpoolOutput{}
+
+// NewSpoolOutput creates a new spool in dir for send, creating the directory if
+// it doesn't exist. Any entries in the directory that weren't sent yet will be
+// sent.
+func NewSpoolOutput(dir string, send func(...Log) error, opts SpoolOptions) (*SpoolOutput, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 1 << 20
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+
+	s := &SpoolOutput{
+		dir:  dir,
+		send: send,
+		opts: opts,
+		segs: make([][]*spoolSegment, len(severity)),
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		return nil, fmt.Errorf("zlog.NewSpoolOutput: %w", err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		wait := opts.FlushInterval
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.kick:
+				if wait > opts.FlushInterval { // Sending failed; wait for the timer.
+					continue
+				}
+				if !t.Stop() {
+					<-t.C
+				}
+			case <-t.C:
+			}
+
+			s.report()
+			if err := s.flush(); err != nil {
+				wait *= 2
+				if wait > opts.MaxBackoff {
+					wait = opts.MaxBackoff
+				}
+				fmt.Fprintf(stderr, "zlog: SpoolOutput: %s (retrying in %s)\n", err, wait)
+			} else {
+				wait = opts.FlushInterval
+			}
+			t.Reset(wait)
+		}
+	}()
+	return s, nil
+}
+
+// Write the Log entry to the spool.
+//
+// The entry is sent synchronously if the output is closed.
+func (s *SpoolOutput) Write(l Log) {
+	s.mu.Lock()
+	err := s.write(l)
+	kick := false
+	if s.written >= s.opts.BatchSize {
+		kick, s.written = true, 0
+	}
+	closed := s.closed
+	s.mu.Unlock()
+
+	if err != nil {
+		fmt.Fprintf(stderr, "zlog: SpoolOutput: %s\n%s\n", err, formatText(l, false))
+		return
+	}
+	if closed {
+		if err := s.flush(); err != nil {
+			fmt.Fprintf(stderr, "zlog: SpoolOutput: %s\n", err)
+		}
+		return
+	}
+	if kick {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped gets the total number of entries that were removed because the spool
+// was too large.
+func (s *SpoolOutput) Dropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+
+// Flush sends all entries in the spool. The entries are kept if sending fails.
+func (s *SpoolOutput) Flush() error { return s.flush() }
+
+// Close stops the background goroutine, sends all entries in the spool, and
+// closes the segment files. The entries are kept if sending fails.
+//
+// The output can still be used after it's closed, but all entries will be
+// sent right away.
+func (s *SpoolOutput) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.report()
+	err := s.flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, segs := range s.segs {
+		for _, seg := range segs {
+			if seg.fp != nil {
+				seg.fp.Close()
+				seg.fp = nil
+			}
+		}
+	}
+	return err
+}
+
+// open reads the segments in the directory.
+func (s *SpoolOutput) open() error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	sent, err := ioutil.ReadFile(filepath.Join(s.dir, "sent"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(sent) > 0 {
+		s.sent, err = strconv.ParseUint(strings.TrimSpace(string(sent)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("reading sent: %w", err)
+		}
+	}
+	s.seq = s.sent
+
+	// The names start with the zero-padded sequence number of the first entry,
+	// so this is in the order they were written.
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.spool"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".spool")
+		i := strings.IndexByte(name, '-')
+		if i == -1 {
+			continue
+		}
+		lvl, err := parseLevel(name[i+1:])
+		if err != nil {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		// Remove partly written lines.
+		if i := bytes.LastIndexByte(b, '\n'); i < len(b)-1 {
+			b = b[:i+1]
+			if err := os.Truncate(f, int64(len(b))); err != nil {
+				return err
+			}
+		}
+
+		seg := &spoolSegment{path: f, size: int64(len(b))}
+		for _, e := range s.decode(seg, b) {
+			if e.Seq > s.seq {
+				s.seq = e.Seq
+			}
+			if e.Seq > s.sent {
+				seg.n++
+			}
+		}
+		if seg.n == 0 {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+			continue
+		}
+		s.segs[severity[lvl]] = append(s.segs[severity[lvl]], seg)
+		s.size += seg.size
+	}
+	return nil
+}
+
+// write the entry to the current segment for the level, removing segments if
+// the spool is too large.
+func (s *SpoolOutput) write(l Log) error {
+	sev := severity[l.Level]
+	e := newSpoolEntry(s.seq+1, l)
+	line, err := jsonMarshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	for s.size+int64(len(line)) > s.opts.MaxSize {
+		lowest := -1
+		for i := range s.segs {
+			if len(s.segs[i]) > 0 {
+				lowest = i
+				break
+			}
+		}
+		// Drop the entry itself if there are only segments with a higher level.
+		if lowest == -1 || lowest > sev {
+			atomic.AddUint64(&s.dropped, 1)
+			atomic.AddUint64(&s.unreported, 1)
+			return nil
+		}
+		if err := s.remove(lowest); err != nil {
+			return err
+		}
+	}
+
+	var seg *spoolSegment
+	if n := len(s.segs[sev]); n > 0 && s.segs[sev][n-1].fp != nil {
+		seg = s.segs[sev][n-1]
+	} else {
+		path := filepath.Join(s.dir, fmt.Sprintf("%020d-%s.spool", e.Seq, levelNames[l.Level]))
+		fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		seg = &spoolSegment{path: path, fp: fp}
+		s.segs[sev] = append(s.segs[sev], seg)
+	}
+
+	n, err := seg.fp.Write(line)
+	seg.size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	s.seq = e.Seq
+	seg.n++
+	s.written++
+	if seg.size >= s.opts.SegmentSize {
+		err = seg.fp.Close()
+		seg.fp = nil
+	}
+	return err
+}
+
+// remove the oldest segment for the severity.
+func (s *SpoolOutput) remove(sev int) error {
+	seg := s.segs[sev][0]
+	s.segs[sev] = s.segs[sev][1:]
+	if seg.fp != nil {
+		seg.fp.Close()
+	}
+	s.size -= seg.size
+	if d := seg.n - seg.sent; d > 0 {
+		atomic.AddUint64(&s.dropped, uint64(d))
+		atomic.AddUint64(&s.unreported, uint64(d))
+	}
+	return os.Remove(seg.path)
+}
+
+// flush sends all entries, until sending fails.
+func (s *SpoolOutput) flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	for {
+		s.mu.Lock()
+		es, segs := s.take(s.opts.BatchSize)
+		s.mu.Unlock()
+		if len(es) == 0 {
+			return nil
+		}
+
+		ls := make([]Log, 0, len(es))
+		for _, e := range es {
+			ls = append(ls, e.log())
+		}
+		err := s.send(ls...)
+
+		s.mu.Lock()
+		if err != nil {
+			s.unread()
+		} else {
+			err = s.commit(es[len(es)-1].Seq, segs)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// take up to n entries in the order they were written, and the segments they
+// were read from.
+func (s *SpoolOutput) take(n int) ([]spoolEntry, []*spoolSegment) {
+	var (
+		es   []spoolEntry
+		segs []*spoolSegment
+	)
+	for len(es) < n {
+		var next *spoolSegment
+		for _, ss := range s.segs {
+			seg := s.head(ss)
+			if seg != nil && (next == nil || seg.buf[0].Seq < next.buf[0].Seq) {
+				next = seg
+			}
+		}
+		if next == nil {
+			break
+		}
+		es, segs = append(es, next.buf[0]), append(segs, next)
+		next.buf = next.buf[1:]
+	}
+	return es, segs
+}
+
+// head gets the first segment with unsent entries, reading the entries if
+// needed.
+func (s *SpoolOutput) head(segs []*spoolSegment) *spoolSegment {
+	for _, seg := range segs {
+		if len(seg.buf) == 0 && seg.read < seg.size {
+			b, err := readAt(seg.path, seg.read, seg.size)
+			if err != nil {
+				fmt.Fprintf(stderr, "zlog: SpoolOutput: %s\n", err)
+				continue
+			}
+			seg.read = seg.size
+			for _, e := range s.decode(seg, b) {
+				if e.Seq > s.sent {
+					seg.buf = append(seg.buf, e)
+				}
+			}
+		}
+		if len(seg.buf) > 0 {
+			return seg
+		}
+	}
+	return nil
+}
+
+// unread clears the read entries, so they're read again from the files.
+func (s *SpoolOutput) unread() {
+	for _, segs := range s.segs {
+		for _, seg := range segs {
+			seg.read, seg.buf = 0, nil
+		}
+	}
+}
+
+// commit marks the entries up to seq as sent, and removes segments with only
+// sent entries.
+func (s *SpoolOutput) commit(seq uint64, segs []*spoolSegment) error {
+	for _, seg := range segs {
+		seg.sent++
+	}
+	s.sent = seq
+
+	tmp := filepath.Join(s.dir, "sent.tmp")
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, "sent")); err != nil {
+		return err
+	}
+
+	for sev := range s.segs {
+		for len(s.segs[sev]) > 0 {
+			seg := s.segs[sev][0]
+			if seg.read < seg.size || len(seg.buf) > 0 {
+				break
+			}
+			seg.n = seg.sent // Don't count as dropped.
+			if err := s.remove(sev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// report writes the number of entries removed since the last report.
+func (s *SpoolOutput) report() {
+	n := atomic.SwapUint64(&s.unreported, 0)
+	if n == 0 {
+		return
+	}
+
+	l := Log{
+		Modules: []string{"zlog"},
+		Level:   LevelWarn,
+		Msg:     fmt.Sprintf("spool output: removed %d log entries because the spool is full", n),
+		Data:    F{"dropped": n},
+		Time:    now(),
+	}
+	s.mu.Lock()
+	err := s.write(l)
+	s.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(stderr, "zlog: SpoolOutput: %s\n%s\n", err, formatText(l, false))
+	}
+}
+
+// decode the JSON lines in b; invalid lines are written to stderr.
+func (s *SpoolOutput) decode(seg *spoolSegment, b []byte) []spoolEntry {
+	var es []spoolEntry
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e spoolEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			fmt.Fprintf(stderr, "zlog: SpoolOutput: %s: %s\n", seg.path, err)
+			continue
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+func readAt(path string, start, end int64) ([]byte, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	b := make([]byte, end-start)
+	_, err = fp.ReadAt(b, start)
+	return b, err
+}
+
+// spoolEntry is a Log entry as it's stored in the spool.
+type spoolEntry struct {
+	Seq       uint64                     `json:"seq"`
+	Time      time.Time                  `json:"time"`
+	Level     int                        `json:"level"`
+	Modules   []string                   `json:"modules,omitempty"`
+	Msg       string                     `json:"msg,omitempty"`
+	Err       *string                    `json:"err,omitempty"`
+	Stack     string                     `json:"stack,omitempty"`
+	Traces    []string                   `json:"traces,omitempty"`
+	Data      map[string]json.RawMessage `json:"data,omitempty"`
+	RequestID string                     `json:"request_id,omitempty"`
+	TraceID   string                     `json:"trace_id,omitempty"`
+	SpanID    string                     `json:"span_id,omitempty"`
+}
+
+func newSpoolEntry(seq uint64, l Log) spoolEntry {
+	e := spoolEntry{
+		Seq:       seq,
+		Time:      l.timestamp(),
+		Level:     l.Level,
+		Modules:   l.Modules,
+		Msg:       l.Msg,
+		Traces:    l.Traces,
+		RequestID: RequestID(l.Ctx),
+	}
+	e.TraceID, e.SpanID = TraceID(l.Ctx)
+
+	if l.Err != nil {
+		err := l.Err
+		// Keep the stack from Recover() separate, for SentryOutput.
+		if se, ok := err.(*stackError); ok {
+			err, e.Stack = se.err, string(se.stack)
+		}
+		msg := err.Error()
+		e.Err = &msg
+	}
+
+	if len(l.Data) > 0 {
+		e.Data = make(map[string]json.RawMessage, len(l.Data))
+		for k, v := range l.Data {
+			e.Data[k] = jsonValue(v)
+		}
+	}
+	return e
+}
+
+func (e spoolEntry) log() Log {
+	l := Log{
+		Time:    e.Time,
+		Level:   e.Level,
+		Modules: e.Modules,
+		Msg:     e.Msg,
+		Traces:  e.Traces,
+	}
+
+	if e.RequestID != "" || e.TraceID != "" || e.SpanID != "" {
+		l.Ctx = context.Background()
+		if e.RequestID != "" {
+			l.Ctx = WithRequestID(l.Ctx, e.RequestID)
+		}
+		if e.TraceID != "" || e.SpanID != "" {
+			l.Ctx = WithTraceID(l.Ctx, e.TraceID, e.SpanID)
+		}
+	}
+
+	if e.Err != nil {
+		l.Err = errors.New(*e.Err)
+		if e.Stack != "" {
+			l.Err = &stackError{err: l.Err, stack: []byte(e.Stack)}
+		}
+	}
+
+	if len(e.Data) > 0 {
+		l.Data = make(F, len(e.Data))
+		for k, v := range e.Data {
+			l.Data[k] = spoolValue(v)
+		}
+	}
+	return l
+}
+
+// spoolValue decodes a JSON value; numbers are decoded as int64 if possible,
+// and objects and arrays as JSON.
+func spoolValue(b json.RawMessage) interface{} {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return string(b)
+	}
+	switch vv := v.(type) {
+	case json.Number:
+		if n, err := vv.Int64(); err == nil {
+			return n
+		}
+		n, _ := vv.Float64()
+		return n
+	case map[string]interface{}, []interface{}:
+		return JSON(b)
+	}
+	return v
+}
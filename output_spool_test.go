@@ -0,0 +1,309 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpoolEntry(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456789, time.UTC)
+	ctx := WithTraceID(WithRequestID(context.Background(), "req1"), "t", "s")
+
+	in := Log{Time: n, Level: LevelErr, Ctx: ctx, Modules: []string{"a", "b"}, Msg: "msg",
+		Err:    &stackError{err: errors.New("oh noes"), stack: []byte("goroutine 1 [running]:\n")},
+		Traces: []string{"t1"},
+		Data: F{"s": "str", "i": 42, "f": 1.5, "b": true, "n": nil, "d": time.Second,
+			"m": map[string]int{"x": 1}, "j": JSON(`[1,2]`), "e": errors.New("e")}}
+
+	b, err := jsonMarshal(newSpoolEntry(1, in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e spoolEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatal(err)
+	}
+	out := e.log()
+
+	if !out.Time.Equal(n) || out.Level != in.Level || !reflect.DeepEqual(out.Modules, in.Modules) ||
+		out.Msg != in.Msg || !reflect.DeepEqual(out.Traces, in.Traces) {
+		t.Errorf("\nout:  %#v\nwant: %#v", out, in)
+	}
+	if out.Err.Error() != in.Err.Error() {
+		t.Errorf("wrong error\nout:  %q\nwant: %q", out.Err, in.Err)
+	}
+	if stack, cause := errorStack(out.Err); stack != "goroutine 1 [running]:" || cause.Error() != "oh noes" {
+		t.Errorf("wrong stack: %q %q", stack, cause)
+	}
+	if tr, sp := TraceID(out.Ctx); RequestID(out.Ctx) != "req1" || tr != "t" || sp != "s" {
+		t.Errorf("wrong ctx: %v", ctxFields(out.Ctx, nil))
+	}
+
+	want := F{"s": "str", "i": int64(42), "f": 1.5, "b": true, "n": nil, "d": int64(time.Second),
+		"m": JSON(`{"x":1}`), "j": JSON(`[1,2]`), "e": "e"}
+	if !reflect.DeepEqual(out.Data, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v", out.Data, want)
+	}
+
+	if l := (spoolEntry{Err: new(string)}).log(); l.Err == nil || l.Ctx != nil || l.Data != nil {
+		t.Errorf("wrong log: %#v", l)
+	}
+}
+
+// spoolDest records sent entries, and fails if fail is set.
+type spoolDest struct {
+	mu   sync.Mutex
+	fail bool
+	msgs []string
+}
+
+func (d *spoolDest) send(ls ...Log) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fail {
+		return errors.New("oh noes")
+	}
+	for _, l := range ls {
+		d.msgs = append(d.msgs, l.Msg)
+	}
+	return nil
+}
+
+func (d *spoolDest) setFail(f bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fail = f
+}
+
+func (d *spoolDest) sent() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := d.msgs
+	d.msgs = nil
+	return m
+}
+
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	return files
+}
+
+func TestSpoolOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := new(spoolDest)
+	d.setFail(true)
+	opts := SpoolOptions{FlushInterval: time.Hour, BatchSize: 2}
+
+	s, err := NewSpoolOutput(dir, d.send, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels := []int{LevelInfo, LevelErr, LevelDbg, LevelInfo, LevelErr}
+	var want []string
+	for i, lvl := range levels {
+		want = append(want, fmt.Sprintf("msg %d", i))
+		s.Write(Log{Level: lvl, Msg: want[i]})
+	}
+	if err := s.Flush(); err == nil || err.Error() != "oh noes" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if got := spoolFiles(t, dir); !reflect.DeepEqual(got, []string{
+		"00000000000000000001-info.spool", "00000000000000000002-error.spool", "00000000000000000003-debug.spool"}) {
+		t.Errorf("wrong files: %v", got)
+	}
+
+	// Send after a failure; the entries should be sent in order.
+	d.setFail(false)
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	if got := spoolFiles(t, dir); len(got) != 0 {
+		t.Errorf("files not removed: %v", got)
+	}
+
+	// Restart with unsent entries; only the unsent entries should be sent.
+	s.Write(Log{Msg: "sent"})
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	d.sent()
+	d.setFail(true)
+	s.Write(Log{Msg: "a"})
+	s.Write(Log{Level: LevelErr, Msg: "b"})
+	stderr = ioutil.Discard
+	defer func() { stderr = os.Stderr }()
+	if err := s.Close(); err == nil {
+		t.Fatal("no error")
+	}
+
+	d.setFail(false)
+	s, err = NewSpoolOutput(dir, d.send, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.sent(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+
+	s, err = NewSpoolOutput(dir, d.send, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(Log{Msg: "c"})
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.sent(); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+
+	// Written right away after Close().
+	s.Close()
+	s.Write(Log{Msg: "d"})
+	if got := d.sent(); !reflect.DeepEqual(got, []string{"d"}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+}
+
+func TestSpoolOutputPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "00000000000000000001-info.spool"),
+		[]byte(`{"seq":1,"time":"2020-06-18T13:14:15Z","level":0,"msg":"a"}`+"\n"+`{"seq":2,"time":"2020-06-1`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := new(spoolDest)
+	s, err := NewSpoolOutput(dir, d.send, SpoolOptions{FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(Log{Msg: "b"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.sent(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+}
+
+func TestSpoolOutputMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := new(spoolDest)
+	d.setFail(true)
+	s, err := NewSpoolOutput(dir, d.send, SpoolOptions{
+		FlushInterval: time.Hour, MaxSize: 700, SegmentSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every line is about 65 bytes, so the debug segments and the oldest info
+	// segment should be removed.
+	n := time.Date(2020, 6, 18, 13, 14, 15, 0, time.UTC)
+	var errs, infos []string
+	for i := 0; i < 6; i++ {
+		errs = append(errs, fmt.Sprintf("error %d", i))
+		s.Write(Log{Time: n, Level: LevelDbg, Msg: fmt.Sprintf("debug %d", i)})
+		s.Write(Log{Time: n, Level: LevelErr, Msg: errs[i]})
+	}
+	for i := 0; i < 6; i++ {
+		infos = append(infos, fmt.Sprintf("info %d", i))
+		s.Write(Log{Time: n, Level: LevelInfo, Msg: infos[i]})
+	}
+	if s.size > 700 {
+		t.Errorf("size is %d", s.size)
+	}
+
+	d.setFail(false)
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := d.sent()
+	if len(got) < len(errs) || !reflect.DeepEqual(got[:len(errs)], errs) {
+		t.Fatalf("errors not sent: %q", got)
+	}
+	got = got[len(errs):]
+	if len(got) == 0 || len(got) == len(infos) || !reflect.DeepEqual(got, infos[len(infos)-len(got):]) {
+		t.Errorf("wrong info entries: %q", got)
+	}
+	dropped := 6 + len(infos) - len(got)
+	if s.Dropped() != uint64(dropped) {
+		t.Errorf("Dropped() = %d; want %d", s.Dropped(), dropped)
+	}
+
+	// Report is written on the next flush.
+	s.report()
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("spool output: removed %d log entries because the spool is full", dropped)
+	if got := d.sent(); !reflect.DeepEqual(got, []string{want}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+	s.Close()
+}
+
+func TestSpoolOutputBackground(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := new(spoolDest)
+	s, err := NewSpoolOutput(dir, d.send, SpoolOptions{FlushInterval: time.Hour, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Sent once there are BatchSize entries.
+	s.Write(Log{Msg: "a"})
+	s.Write(Log{Msg: "b"})
+	var got []string
+	for i := 0; i < 100 && len(got) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		got = append(got, d.sent()...)
+	}
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("wrong entries: %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package zlog
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"sort"
 	"strings"
 
@@ -19,6 +20,8 @@ var (
 		LevelErr:   "\x1b[48;5;9m  \x1b[0m ",   // Red
 		LevelDbg:   "\x1b[48;5;247m  \x1b[0m ", // Grey
 		LevelTrace: "\x1b[48;5;247m  \x1b[0m ", // Grey
+		LevelWarn:  "\x1b[48;5;11m  \x1b[0m ",  // Yellow
+		LevelFatal: "\x1b[48;5;1m  \x1b[0m ",   // Dark red
 	}
 
 	messages = map[int]string{
@@ -26,27 +29,76 @@ var (
 		LevelErr:   "ERROR: ",
 		LevelDbg:   "DEBUG: ",
 		LevelTrace: "TRACE: ",
+		LevelWarn:  "WARN: ",
+		LevelFatal: "FATAL: ",
+	}
+
+	// Level names as used in the structured (JSON, logfmt) formats.
+	levelNames = map[int]string{
+		LevelInfo:  "info",
+		LevelErr:   "error",
+		LevelDbg:   "debug",
+		LevelTrace: "trace",
+		LevelWarn:  "warn",
+		LevelFatal: "fatal",
 	}
 )
 
 // JSON strings aren't quoted in the output.
 type JSON string
 
-func format(l Log) string {
+// valueFmt gets the fmt verb to format a Data value with.
+func valueFmt(v interface{}) string {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint64:
+		return "%d"
+	case float32, float64:
+		return "%f"
+	case JSON:
+		return "%s"
+	case string, []byte, []rune:
+		return "%q"
+	case bool:
+		return "%t"
+	default:
+		return "%v"
+	}
+}
+
+// valueString formats a Data value without quoting strings.
+func valueString(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case []byte:
+		return string(vv)
+	case []rune:
+		return string(vv)
+	}
+	return fmt.Sprintf(valueFmt(v), v)
+}
+
+func format(l Log) string { return formatText(l, enableColors) }
+
+func formatText(l Log, color bool) string { return formatTextTime(l, color, Config.FmtTime) }
+
+// formatTextTime is formatText() with the timestamp formatted with fmtTime
+// instead of Config.FmtTime.
+func formatTextTime(l Log, color bool, fmtTime string) string {
 	b := &strings.Builder{}
 
 	// Write any existing trace logs on error.
-	if l.Level == LevelErr {
+	if l.Level == LevelErr || l.Level == LevelFatal {
 		for _, t := range l.Traces {
 			b.Write([]byte(t + "\n"))
 		}
 	}
 
-	if enableColors {
+	if color {
 		b.WriteString(colors[l.Level])
 	}
 
-	b.WriteString(now().Format(Config.FmtTime))
+	b.WriteString(l.timestamp().Format(fmtTime))
 	if len(l.Modules) > 0 {
 		b.WriteString(strings.Join(l.Modules, ": "))
 		b.WriteString(": ")
@@ -71,24 +123,8 @@ func format(l Log) string {
 		data := make([]string, len(l.Data))
 		i := 0
 		for k, v := range l.Data {
-			vfmt := "%v"
-			switch v.(type) {
-			case int, int8, int16, int32, int64, uint, uint8, uint16, uint64:
-				vfmt = "%d"
-			case float32, float64:
-				vfmt = "%f"
-			case JSON:
-				vfmt = "%s"
-			case string, []byte, []rune:
-				vfmt = "%q"
-			case bool:
-				vfmt = "%t"
-			default:
-				data[i] = fmt.Sprintf("%s = %v", k, v)
-			}
-
 			pad := strings.Repeat(" ", width-len(k))
-			data[i] = fmt.Sprintf("%s%s = "+vfmt, k, pad, v)
+			data[i] = fmt.Sprintf("%s%s = "+valueFmt(v), k, pad, v)
 
 			i++
 		}
@@ -104,10 +140,28 @@ func format(l Log) string {
 	return b.String()
 }
 
+// stdFile gets the file to write this Log entry to: stderr for errors, and
+// stdout for everything else.
+func stdFile(l Log) *os.File {
+	if l.Level == LevelErr || l.Level == LevelFatal {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
 func output(l Log) {
-	out := os.Stdout
-	if l.Level == LevelErr {
-		out = os.Stderr
+	// Use the native protocol if we're running as a systemd service, unless
+	// Config.Format was changed.
+	if isDefaultFormat() {
+		if j := journal(); j != nil {
+			j.Write(l)
+			return
+		}
 	}
-	fmt.Fprintln(out, Config.Format(l))
+	fmt.Fprintln(stdFile(l), Config.Format(l))
+}
+
+// isDefaultFormat reports if Config.Format is the default format().
+func isDefaultFormat() bool {
+	return reflect.ValueOf(Config.Format).Pointer() == reflect.ValueOf(format).Pointer()
 }
@@ -0,0 +1,258 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog message formats for SyslogOptions.Format.
+const (
+	RFC5424 = iota
+	RFC3164
+)
+
+// SyslogOptions are options for NewSyslogOutput().
+type SyslogOptions struct {
+	// Network and address to connect to; the network can be "unixgram",
+	// "unix", "udp", or "tcp". The default is "unixgram" on "/dev/log".
+	//
+	// Messages on stream connections ("tcp", "unix") are framed with octet
+	// counting from RFC 6587.
+	Network, Addr string
+
+	// Message format; the default is RFC5424.
+	Format int
+
+	// Syslog facility; the default is 1 (user).
+	Facility int
+
+	// App name and hostname; the defaults are the program name and
+	// os.Hostname().
+	AppName, Hostname string
+
+	// Structured data ID for the Data fields in RFC 5424 messages; the default
+	// is "zlog@32473".
+	SDID string
+}
+
+// SyslogOutput sends entries to a syslog daemon.
+//
+// For RFC 5424 messages the modules are used as the MSGID and the Data fields
+// as structured data; for RFC 3164 messages they're added to the message.
+//
+// It will reconnect if sending a message fails; errors are written to stderr
+// together with the entry.
+type SyslogOutput struct {
+	mu   sync.Mutex
+	opts SyslogOptions
+	pid  int
+	conn net.Conn
+}
+
+var _ Sink = &SyslogOutput{}
+
+// NewSyslogOutput creates a new syslog output and connects to the daemon.
+func NewSyslogOutput(opts SyslogOptions) (*SyslogOutput, error) {
+	if opts.Network == "" {
+		opts.Network, opts.Addr = "unixgram", "/dev/log"
+	}
+	if opts.Facility == 0 {
+		opts.Facility = 1
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.SDID == "" {
+		opts.SDID = "zlog@32473"
+	}
+
+	s := &SyslogOutput{opts: opts, pid: os.Getpid()}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write the Log entry.
+func (s *SyslogOutput) Write(l Log) {
+	if err := s.Send(l); err != nil {
+		fmt.Fprintf(stderr, "zlog: SyslogOutput: %s\n%s\n", err, formatText(l, false))
+	}
+}
+
+// Send the Log entries, reconnecting once if sending fails.
+func (s *SyslogOutput) Send(ls ...Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range ls {
+		msg := s.format(l)
+		if s.opts.Network == "tcp" || s.opts.Network == "unix" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		err := s.send(msg)
+		if err != nil {
+			if err := s.connect(); err != nil {
+				return err
+			}
+			err = s.send(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op, as messages aren't buffered.
+func (s *SyslogOutput) Flush() error { return nil }
+
+// Close the connection.
+func (s *SyslogOutput) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogOutput) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	c, err := net.DialTimeout(s.opts.Network, s.opts.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = c
+	return nil
+}
+
+func (s *SyslogOutput) send(msg []byte) error {
+	if s.conn == nil {
+		return errNotConnected
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+var errNotConnected = errors.New("not connected")
+
+// syslogSeverity maps zlog levels to syslog severities.
+var syslogSeverity = map[int]int{
+	LevelFatal: 2, // crit
+	LevelErr:   3, // err
+	LevelWarn:  4, // warning
+	LevelInfo:  6, // info
+	LevelDbg:   7, // debug
+	LevelTrace: 7, // debug
+}
+
+func (s *SyslogOutput) format(l Log) []byte {
+	pri := s.opts.Facility*8 + syslogSeverity[l.Level]
+	msg := l.Msg
+	if l.Err != nil {
+		msg = l.Err.Error()
+	}
+
+	b := new(strings.Builder)
+	if s.opts.Format == RFC3164 {
+		fmt.Fprintf(b, "<%d>%s %s %s[%d]: ", pri, l.timestamp().Format(time.Stamp),
+			s.opts.Hostname, s.opts.AppName, s.pid)
+		if len(l.Modules) > 0 {
+			b.WriteString(strings.Join(l.Modules, ": ") + ": ")
+		}
+		b.WriteString(msg)
+		for _, k := range sortedKeys(l.Data) {
+			b.WriteString(" " + logfmtKey(k) + "=" + logfmtValue(l.Data[k]))
+		}
+		return []byte(b.String())
+	}
+
+	msgID := "-"
+	if len(l.Modules) > 0 {
+		msgID = syslogName(strings.Join(l.Modules, ":"), 32)
+	}
+	fmt.Fprintf(b, "<%d>1 %s %s %s %d %s ", pri, l.timestamp().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogName(s.opts.Hostname, 255), syslogName(s.opts.AppName, 48), s.pid, msgID)
+
+	if len(l.Data) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + s.opts.SDID)
+		for _, k := range sortedKeys(l.Data) {
+			fmt.Fprintf(b, ` %s="%s"`, syslogParam(k), syslogEscape(valueString(l.Data[k])))
+		}
+		b.WriteString("]")
+	}
+
+	if msg != "" {
+		b.WriteString(" " + msg)
+	}
+	return []byte(b.String())
+}
+
+// syslogName replaces anything that's not printable ASCII, and truncates to n
+// bytes.
+func syslogName(s string, n int) string {
+	if s == "" {
+		return "-"
+	}
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > n {
+		s = s[:n]
+	}
+	return s
+}
+
+// syslogParam makes a valid SD-PARAM name.
+func syslogParam(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "_"
+	}
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+// syslogEscape escapes a SD-PARAM value.
+func syslogEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+func sortedKeys(f F) []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
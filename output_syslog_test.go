@@ -0,0 +1,161 @@
+package zlog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	n := time.Date(2020, 6, 18, 13, 14, 15, 123456000, time.UTC)
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		format int
+		in     Log
+		want   string
+	}{
+		{RFC5424, Log{Msg: "w00t"},
+			`<14>1 2020-06-18T13:14:15.123456Z host app ` + pid + ` - - w00t`},
+		{RFC5424, Log{Level: LevelErr, Modules: []string{"a", "b c"}, Err: errors.New("oh noes"),
+			Data: F{"k": "v", "n": 42, `we"ird=]`: `"q" ]\`}},
+			`<11>1 2020-06-18T13:14:15.123456Z host app ` + pid + ` a:b_c [zlog@32473 k="v" n="42" we_ird__="\"q\" \]\\"] oh noes`},
+		{RFC5424, Log{Level: LevelDbg, Data: F{"k": "v", "r": []rune("hi")}},
+			`<15>1 2020-06-18T13:14:15.123456Z host app ` + pid + ` - [zlog@32473 k="v" r="hi"]`},
+		{RFC3164, Log{Level: LevelWarn, Msg: "w00t"},
+			`<12>Jun 18 13:14:15 host app[` + pid + `]: w00t`},
+		{RFC3164, Log{Level: LevelFatal, Modules: []string{"a", "b"}, Msg: "w00t", Data: F{"k": "v v"}},
+			`<10>Jun 18 13:14:15 host app[` + pid + `]: a: b: w00t k="v v"`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			s := &SyslogOutput{pid: os.Getpid(), opts: SyslogOptions{
+				Format: tt.format, Facility: 1, AppName: "app", Hostname: "host", SDID: "zlog@32473",
+			}}
+			tt.in.Time = n
+			if out := string(s.format(tt.in)); out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		testSyslogPacket(t, pc, SyslogOptions{Network: "udp", Addr: pc.LocalAddr().String()})
+	})
+
+	t.Run("unixgram", func(t *testing.T) {
+		addr := filepath.Join(dir, "log")
+		pc, err := net.ListenPacket("unixgram", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		testSyslogPacket(t, pc, SyslogOptions{Network: "unixgram", Addr: addr})
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		msgs := make(chan string, 10)
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					r := bufio.NewReader(c)
+					for {
+						l, err := r.ReadString(' ')
+						if err != nil {
+							return
+						}
+						n, _ := strconv.Atoi(strings.TrimSpace(l))
+						msg := make([]byte, n)
+						if _, err := io.ReadFull(r, msg); err != nil {
+							return
+						}
+						msgs <- string(msg)
+					}
+				}()
+			}
+		}()
+
+		s, err := NewSyslogOutput(SyslogOptions{Network: "tcp", Addr: ln.Addr().String(), AppName: "app"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		s.Write(Log{Msg: "one\ntwo"})
+		s.conn.Close() // Force a reconnect.
+		s.Write(Log{Msg: "three"})
+
+		// Order isn't guaranteed, as they're on different connections.
+		var got []string
+		for i := 0; i < 2; i++ {
+			select {
+			case m := <-msgs:
+				if !strings.HasPrefix(m, "<14>1 ") {
+					t.Errorf("wrong message: %q", m)
+				}
+				got = append(got, m[strings.LastIndex(m, " - - ")+5:])
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint([]string{"one\ntwo", "three"}) {
+			t.Errorf("wrong messages: %q", got)
+		}
+	})
+}
+
+func testSyslogPacket(t *testing.T, pc net.PacketConn, opts SyslogOptions) {
+	opts.AppName, opts.Format = "app", RFC3164
+	s, err := NewSyslogOutput(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Write(Log{Level: LevelErr, Err: errors.New("oh noes")})
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := string(buf[:n]); !strings.HasPrefix(m, "<11>") || !strings.HasSuffix(m, " app["+strconv.Itoa(os.Getpid())+"]: oh noes") {
+		t.Errorf("wrong message: %q", m)
+	}
+}
@@ -0,0 +1,66 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Minimal protobuf encoder, for the outputs which need it; it's not worth
+// adding a dependency for the few messages we need.
+//
+// All of these append the field to b, including for zero values; callers need
+// to skip default values if needed.
+
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+)
+
+func pbAppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func pbTag(b []byte, field, wire int) []byte {
+	return pbAppendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func pbUint(b []byte, field int, v uint64) []byte {
+	return pbAppendVarint(pbTag(b, field, pbVarint), v)
+}
+
+func pbInt(b []byte, field int, v int64) []byte { return pbUint(b, field, uint64(v)) }
+
+func pbBool(b []byte, field int, v bool) []byte {
+	if v {
+		return pbUint(b, field, 1)
+	}
+	return pbUint(b, field, 0)
+}
+
+func pbFixed(b []byte, field int, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(pbTag(b, field, pbFixed64), buf[:]...)
+}
+
+func pbDouble(b []byte, field int, v float64) []byte {
+	return pbFixed(b, field, math.Float64bits(v))
+}
+
+func pbBytesField(b []byte, field int, v []byte) []byte {
+	return append(pbAppendVarint(pbTag(b, field, pbBytes), uint64(len(v))), v...)
+}
+
+func pbString(b []byte, field int, v string) []byte {
+	return append(pbAppendVarint(pbTag(b, field, pbBytes), uint64(len(v))), v...)
+}
+
+// pbMessage appends an embedded message, as encoded by enc.
+func pbMessage(b []byte, field int, enc func([]byte) []byte) []byte {
+	return pbBytesField(b, field, enc(nil))
+}
@@ -0,0 +1,93 @@
+package zlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestProtobuf(t *testing.T) {
+	// Examples from the protobuf encoding documentation.
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{pbUint(nil, 1, 150), "089601"},
+		{pbInt(nil, 1, -2), "08feffffffffffffffff01"},
+		{pbString(nil, 2, "testing"), "120774657374696e67"},
+		{pbMessage(nil, 3, func(b []byte) []byte { return pbUint(b, 1, 150) }), "1a03089601"},
+		{pbBool(nil, 1, true), "0801"},
+		{pbBool(nil, 1, false), "0800"},
+		{pbFixed(nil, 1, 1), "090100000000000000"},
+		{pbDouble(nil, 1, 1.5), "09000000000000f83f"},
+		{pbBytesField(nil, 16, []byte{1, 2}), "8201020102"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			if got := fmt.Sprintf("%x", tt.in); got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// pbField is a decoded protobuf field; the value is an uint64 for varints and
+// fixed values, and a []byte for length-delimited values.
+type pbField struct {
+	num int
+	val interface{}
+}
+
+// pbDecode decodes the fields in a protobuf message.
+func pbDecode(t *testing.T, b []byte) []pbField {
+	t.Helper()
+	var fields []pbField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid tag in %x", b)
+		}
+		b = b[n:]
+
+		f := pbField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case pbVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("invalid varint in %x", b)
+			}
+			f.val, b = v, b[n:]
+		case pbFixed64:
+			f.val, b = binary.LittleEndian.Uint64(b), b[8:]
+		case pbBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || int(l) > len(b)-n {
+				t.Fatalf("invalid length in %x", b)
+			}
+			f.val, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("unknown wire type %d", tag&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// pbGet gets all values for the field path, e.g. pbGet(b, 1, 2) gets field 2
+// in all the messages in field 1.
+func pbGet(t *testing.T, b []byte, path ...int) []interface{} {
+	t.Helper()
+	vals := []interface{}{b}
+	for _, p := range path {
+		var next []interface{}
+		for _, v := range vals {
+			for _, f := range pbDecode(t, v.([]byte)) {
+				if f.num == p {
+					next = append(next, f.val)
+				}
+			}
+		}
+		vals = next
+	}
+	return vals
+}
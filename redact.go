@@ -0,0 +1,240 @@
+package zlog
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redact configures the redaction of sensitive data, in LogConfig.Redact.
+type Redact struct {
+	// Fields to redact, matched case-insensitive against the Data keys and the
+	// form and query parameters in FieldsRequest(). A "*" matches any number
+	// of characters, e.g. "*password*".
+	Fields []string
+
+	// Headers to redact in FieldsRequest(), matched case-insensitive. A "*"
+	// matches any number of characters.
+	Headers []string
+
+	// Patterns to redact from string values in Data, Msg, Err, and Traces.
+	// Matches are replaced with Mask, or "[REDACTED]" if Mask is empty.
+	Values []*regexp.Regexp
+
+	// Replace the values of redacted fields and headers with this text, rather
+	// than removing them.
+	Mask string
+}
+
+// Common patterns for Redact.Values.
+//
+// RedactCreditCard only redacts numbers which pass the Luhn check, so that
+// other long numbers such as order IDs aren't redacted.
+var (
+	RedactCreditCard = regexp.MustCompile(`\b(?:4\d{3}|5[1-5]\d{2}|2[2-7]\d{2}|6011|65\d{2}|3[47]\d{2})[ -]?\d{4,6}[ -]?\d{4,5}(?:[ -]?\d{1,4})?\b`)
+	RedactBearer     = regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9._~+/-]+=*`)
+	RedactEmail      = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+)
+
+func defaultRedact() Redact {
+	return Redact{
+		Fields: []string{"password", "passwd", "secret", "client_secret", "token",
+			"access_token", "refresh_token", "id_token", "api_token", "api_key", "apikey"},
+		Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+			"X-Api-Key", "X-Auth-Token", "X-Csrf-Token", "X-Xsrf-Token"},
+		Values: []*regexp.Regexp{RedactCreditCard, RedactBearer},
+	}
+}
+
+func (r Redact) isZero() bool {
+	return len(r.Fields) == 0 && len(r.Values) == 0
+}
+
+// apply the redaction to a Log entry. The Data map is copied, as it may be
+// shared.
+func (r Redact) apply(l Log) Log {
+	if r.isZero() {
+		return l
+	}
+
+	if len(l.Data) > 0 {
+		data := make(F, len(l.Data))
+		for k, v := range l.Data {
+			if r.field(k) {
+				if r.Mask != "" {
+					data[k] = r.Mask
+				}
+				continue
+			}
+
+			switch vv := v.(type) {
+			case string:
+				v = r.value(vv)
+			case JSON:
+				v = JSON(r.value(string(vv)))
+			case []byte:
+				if s := string(vv); r.value(s) != s {
+					v = r.value(s)
+				}
+			case error:
+				v = r.error(vv)
+			}
+			data[k] = v
+		}
+		l.Data = data
+	}
+
+	l.Msg = r.value(l.Msg)
+	if l.Err != nil {
+		l.Err = r.error(l.Err)
+	}
+	if len(l.Traces) > 0 {
+		traces := make([]string, len(l.Traces))
+		for i := range l.Traces {
+			traces[i] = r.value(l.Traces[i])
+		}
+		l.Traces = traces
+	}
+	return l
+}
+
+// field reports if this field should be redacted.
+func (r Redact) field(k string) bool { return globAny(r.Fields, k) }
+
+// header reports if this header should be redacted.
+func (r Redact) header(k string) bool { return globAny(r.Headers, k) }
+
+// value redacts all values matching the patterns.
+func (r Redact) value(s string) string {
+	if s == "" {
+		return s
+	}
+	mask := r.Mask
+	if mask == "" {
+		mask = "[REDACTED]"
+	}
+	for _, re := range r.Values {
+		if re == RedactCreditCard {
+			s = redactCards(s, mask)
+			continue
+		}
+		s = re.ReplaceAllLiteralString(s, mask)
+	}
+	return s
+}
+
+// redactCards redacts credit card numbers which pass the Luhn check.
+func redactCards(s, mask string) string {
+	// Most strings don't have enough digits to be a card number, and counting
+	// them is a lot faster than the regexp.
+	n := 0
+	for i := 0; i < len(s) && n < 13; i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	if n < 13 {
+		return s
+	}
+
+	return RedactCreditCard.ReplaceAllStringFunc(s, func(m string) string {
+		if !luhn(m) {
+			return m
+		}
+		return mask
+	})
+}
+
+// luhn reports if the digits in s pass the Luhn check; other characters are
+// ignored.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+// values redacts url.Values; this modifies v in-place, and reports if anything
+// was redacted.
+func (r Redact) values(v url.Values) bool {
+	changed := false
+	for k := range v {
+		if r.field(k) {
+			changed = true
+			if r.Mask == "" {
+				delete(v, k)
+			} else {
+				v[k] = []string{r.Mask}
+			}
+		}
+	}
+	return changed
+}
+
+// error redacts the error message. The original error is kept for errors.Is()
+// and errors.As(), as is the stack trace from Recover().
+func (r Redact) error(err error) error {
+	if se, ok := err.(*stackError); ok {
+		if e := r.error(se.err); e != se.err {
+			return &stackError{err: e, stack: se.stack}
+		}
+		return err
+	}
+	if s := err.Error(); r.value(s) != s {
+		return &redactedError{msg: r.value(s), err: err}
+	}
+	return err
+}
+
+// redactedError is an error with a redacted message.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+func globAny(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	for _, p := range patterns {
+		if globMatch(strings.ToLower(p), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports if s matches the pattern, where "*" matches any number of
+// characters.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i == -1 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
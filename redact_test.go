@@ -0,0 +1,170 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, in string
+		want        bool
+	}{
+		{"", "", true},
+		{"a", "a", true},
+		{"a", "ab", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"*password*", "password", true},
+		{"*password*", "user_password_hash", true},
+		{"*password*", "passwd", false},
+		{"x-*-token", "x-auth-token", true},
+		{"x-*-token", "x-token", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "acb", false},
+		{"ab*ba", "aba", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.in, func(t *testing.T) {
+			if got := globMatch(tt.pattern, tt.in); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	err := errors.New("user a@example.com: invalid")
+	tests := []struct {
+		redact Redact
+		in     Log
+		want   Log
+	}{
+		{Redact{}, Log{Msg: "password"}, Log{Msg: "password"}},
+		{defaultRedact(),
+			Log{Msg: "card 4111 1111 1111 1111", Data: F{"Password": "x", "user": "y", "n": 1}},
+			Log{Msg: "card [REDACTED]", Data: F{"user": "y", "n": 1}}},
+		{defaultRedact(),
+			Log{Data: F{"access_token": "x", "max_tokens": 1, "token_count": 2}},
+			Log{Data: F{"max_tokens": 1, "token_count": 2}}},
+		{Redact{Fields: []string{"*password*"}, Mask: "***"},
+			Log{Data: F{"db_password": "x", "user": "y"}},
+			Log{Data: F{"db_password": "***", "user": "y"}}},
+		{Redact{Values: []*regexp.Regexp{RedactEmail, RedactBearer}},
+			Log{
+				Err:    err,
+				Data:   F{"h": "Bearer abc.def", "b": []byte("x@example.org"), "j": JSON(`{"e":"x@example.org"}`)},
+				Traces: []string{"trace a@example.com"},
+			},
+			Log{
+				Err:    &redactedError{"user [REDACTED]: invalid", err},
+				Data:   F{"h": "[REDACTED]", "b": "[REDACTED]", "j": JSON(`{"e":"[REDACTED]"}`)},
+				Traces: []string{"trace [REDACTED]"},
+			}},
+		{Redact{Values: []*regexp.Regexp{RedactCreditCard}},
+			Log{Msg: "1592492055000 4111-1111-1111-1111 378282246310005"},
+			Log{Msg: "1592492055000 [REDACTED] [REDACTED]"}},
+		{Redact{Values: []*regexp.Regexp{RedactCreditCard}}, // Fail the Luhn check.
+			Log{Msg: "order 4111111111111112, id 5500000000000001"},
+			Log{Msg: "order 4111111111111112, id 5500000000000001"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			out := tt.redact.apply(tt.in)
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v", out, tt.want)
+			}
+		})
+	}
+
+	t.Run("error chain", func(t *testing.T) {
+		r := Redact{Values: []*regexp.Regexp{RedactEmail}}
+		se := &stackError{err: fmt.Errorf("x@example.com: %w", os.ErrNotExist), stack: []byte("stack")}
+		out := r.apply(Log{Err: se, Data: F{"e": se}})
+
+		for _, e := range []error{out.Err, out.Data["e"].(error)} {
+			if !errors.Is(e, os.ErrNotExist) {
+				t.Errorf("not os.ErrNotExist: %#v", e)
+			}
+			stack, cause := errorStack(e)
+			if stack != "stack" || cause.Error() != "[REDACTED]: file does not exist" {
+				t.Errorf("stack %q; cause %q", stack, cause)
+			}
+		}
+	})
+
+	t.Run("no modify", func(t *testing.T) {
+		d := F{"password": "x"}
+		defaultRedact().apply(Log{Data: d})
+		if d["password"] != "x" {
+			t.Error("modified Data")
+		}
+	})
+}
+
+func TestRedactFieldsRequest(t *testing.T) {
+	defer func() { Config.Redact = defaultRedact() }()
+
+	r, _ := http.NewRequest("POST", "/path?token=secret&k=v", nil)
+	r.Header.Set("Authorization", "Basic xxx")
+	r.Header.Set("Cookie", "session=xxx")
+	r.Header.Set("User-Agent", "x")
+	r.Form = url.Values{"user": {"u"}, "password": {"p"}}
+
+	got := FieldsRequest(r).Data
+	want := F{
+		"http_method":     "POST",
+		"http_url":        "/path?k=v",
+		"http_form":       "user=u",
+		"http_host":       "",
+		"http.User-Agent": "x",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	Config.Redact.Mask = "-"
+	got = FieldsRequest(r).Data
+	want = F{
+		"http_method":        "POST",
+		"http_url":           "/path?k=v&token=-",
+		"http_form":          "password=-&user=u",
+		"http_host":          "",
+		"http.Authorization": "-",
+		"http.Cookie":        "-",
+		"http.User-Agent":    "x",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if r.Form.Get("password") != "p" {
+		t.Error("modified request form")
+	}
+}
+
+func TestRedactRunOutputs(t *testing.T) {
+	var got Log
+	Config.Outputs = []OutputFunc{func(l Log) { got = l }}
+	Module("x").Field("api_token", "t").Print("Bearer xyz")
+	if got.Msg != "[REDACTED]" || len(got.Data) != 0 {
+		t.Errorf("%#v", got)
+	}
+}
+
+func TestRedactTrace(t *testing.T) {
+	var got Log
+	Config.Outputs = []OutputFunc{func(l Log) { got = l }}
+	Module("x").Field("password", "hunter2").Trace("login").Print("done")
+	if len(got.Traces) != 1 || strings.Contains(got.Traces[0], "hunter2") {
+		t.Errorf("%#v", got.Traces)
+	}
+}
@@ -0,0 +1,93 @@
+package zlog
+
+import "encoding/binary"
+
+// Minimal snappy encoder for the block format (not the framed/stream format).
+//
+// This isn't as fast or as good as the reference encoder, but it's simple and
+// compresses log lines reasonably well.
+
+// snappyEncode compresses src.
+func snappyEncode(src []byte) []byte {
+	dst := pbAppendVarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+
+	// Compress in blocks of 64K, like the reference encoder, so that offsets
+	// always fit in 2 bytes.
+	for len(src) > 0 {
+		p := src
+		if len(p) > 65536 {
+			p = p[:65536]
+		}
+		src = src[len(p):]
+		dst = snappyBlock(dst, p)
+	}
+	return dst
+}
+
+func snappyBlock(dst, src []byte) []byte {
+	if len(src) < 16 {
+		return snappyLiteral(dst, src)
+	}
+
+	const bits = 14
+	var (
+		table [1 << bits]int32 // Position+1 of the last occurrence of a hash.
+		s     int              // Current position.
+		lit   int              // Start of the pending literal.
+	)
+	for s+4 <= len(src) {
+		cur := binary.LittleEndian.Uint32(src[s:])
+		h := (cur * 0x1e35a7bd) >> (32 - bits)
+		cand := int(table[h]) - 1
+		table[h] = int32(s + 1)
+
+		if cand < 0 || binary.LittleEndian.Uint32(src[cand:]) != cur {
+			s++
+			continue
+		}
+
+		dst = snappyLiteral(dst, src[lit:s])
+		base, off := s, s-cand
+		for s += 4; s < len(src) && src[s] == src[s-off]; s++ {
+		}
+		dst = snappyCopy(dst, off, s-base)
+		lit = s
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	n := len(lit) - 1
+	switch {
+	case n < 0:
+		return dst
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy writes a copy of length bytes from offset bytes back; length is
+// always at least 4.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+}
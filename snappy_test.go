@@ -0,0 +1,99 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSnappy(t *testing.T) {
+	rnd := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(rnd)
+
+	tests := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("hello, world"),
+		[]byte(strings.Repeat("a", 100)),
+		[]byte(strings.Repeat("abcdefgh", 10000)),
+		[]byte(strings.Repeat(`level=info msg="w00t" k=v`+"\n", 5000)),
+		rnd[:70],
+		rnd,
+		append(append([]byte{}, rnd[:3000]...), rnd[:3000]...),
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			enc := snappyEncode(tt)
+			dec, err := snappyDecode(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dec, tt) {
+				t.Errorf("decoded not the same: %d bytes; want %d", len(dec), len(tt))
+			}
+			if len(tt) > 1000 && bytes.Count(tt, tt[:8]) > 10 && len(enc) > len(tt)/5 {
+				t.Errorf("not compressed: %d bytes from %d bytes", len(enc), len(tt))
+			}
+		})
+	}
+}
+
+// snappyDecode is a straightforward implementation of the format
+// description, to check the encoder.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, l := binary.Uvarint(src)
+	if l <= 0 {
+		return nil, fmt.Errorf("invalid length")
+	}
+	src = src[l:]
+
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag>>2) + 1
+			src = src[1:]
+			if length > 60 {
+				nb := length - 60
+				length = 1
+				for i := 0; i < nb; i++ {
+					length += int(src[i]) << (8 * i)
+				}
+				src = src[nb:]
+			}
+			if length > len(src) {
+				return nil, fmt.Errorf("literal too long")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			length = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("invalid offset %d at %d", offset, len(dst))
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("wrong length: %d; want %d", len(dst), n)
+	}
+	return dst, nil
+}
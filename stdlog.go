@@ -0,0 +1,173 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Writer is an io.Writer which logs every line as a Log entry; this is useful
+// for libraries that only accept an io.Writer or *log.Logger:
+//
+//	srv := &http.Server{
+//	    ErrorLog: zlog.NewWriter(zlog.Module("http"), zlog.LevelInfo).
+//	        Match(regexp.MustCompile(`^http: TLS handshake error`), zlog.LevelErr).
+//	        StdLogger(),
+//	}
+//
+// The date, time, and file added by the log package are removed if the flags
+// are set with Flags(), for example for the standard logger:
+//
+//	log.SetOutput(zlog.NewWriter(zlog.Module("log"), zlog.LevelInfo).Flags(log.Flags()))
+//
+// Partial lines are kept until a newline is written or Flush() is called.
+type Writer struct {
+	mu     sync.Mutex
+	l      Log
+	level  int
+	prefix string
+	flags  int
+	match  []writerMatch
+	buf    []byte
+}
+
+type writerMatch struct {
+	re    *regexp.Regexp
+	level int
+}
+
+var (
+	reStdDate      = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} `)
+	reStdTime      = regexp.MustCompile(`^\d{2}:\d{2}:\d{2} `)
+	reStdTimeMicro = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}\.\d{6} `)
+	reStdFile      = regexp.MustCompile(`^\S+:\d+: `)
+)
+
+// log.Lmsgprefix, which was added in Go 1.14.
+const stdMsgprefix = 1 << 6
+
+// NewWriter creates a new Writer which logs every line to l with the given
+// level.
+//
+// LevelFatal is logged as LevelErr, and LevelTrace as LevelDbg.
+func NewWriter(l Log, level int) *Writer {
+	return &Writer{l: l, level: level}
+}
+
+// StdLogger creates a new log.Logger which writes to this Writer, with the
+// flags set with Flags().
+func (w *Writer) StdLogger() *log.Logger {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return log.New(w, "", w.flags)
+}
+
+// Flags sets the flags of the log.Logger which writes to this Writer, such as
+// log.LstdFlags, so that the date, time, and file it adds are removed.
+//
+// This isn't updated if the flags of the log.Logger are changed with
+// SetFlags().
+func (w *Writer) Flags(flag int) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flags = flag
+	return w
+}
+
+// Prefix sets a prefix to remove from every line, such as the prefix set with
+// log.SetPrefix().
+func (w *Writer) Prefix(p string) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prefix = p
+	return w
+}
+
+// Match logs lines matching the regular expression with a different level.
+//
+// The first matching expression is used.
+func (w *Writer) Match(re *regexp.Regexp, level int) *Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.match = append(w.match, writerMatch{re: re, level: level})
+	return w
+}
+
+// Write p, logging every complete line.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		w.log(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any partial line.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *Writer) log(line string) {
+	line = w.strip(strings.TrimRight(line, "\r"))
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	level := w.level
+	for _, m := range w.match {
+		if m.re.MatchString(line) {
+			level = m.level
+			break
+		}
+	}
+
+	switch level {
+	case LevelErr, LevelFatal:
+		w.l.Error(errors.New(line))
+	case LevelWarn:
+		w.l.Warn(line)
+	case LevelDbg, LevelTrace:
+		w.l.Debug(line)
+	default:
+		w.l.Print(line)
+	}
+}
+
+// strip the prefix and the text added by the log package for the flags.
+func (w *Writer) strip(line string) string {
+	if w.prefix != "" && w.flags&stdMsgprefix == 0 {
+		line = strings.TrimPrefix(line, w.prefix)
+	}
+	if w.flags&log.Ldate != 0 {
+		line = reStdDate.ReplaceAllString(line, "")
+	}
+	if w.flags&log.Lmicroseconds != 0 {
+		line = reStdTimeMicro.ReplaceAllString(line, "")
+	} else if w.flags&log.Ltime != 0 {
+		line = reStdTime.ReplaceAllString(line, "")
+	}
+	if w.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		line = reStdFile.ReplaceAllString(line, "")
+	}
+	if w.prefix != "" && w.flags&stdMsgprefix != 0 {
+		line = strings.TrimPrefix(line, w.prefix)
+	}
+	return line
+}
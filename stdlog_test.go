@@ -0,0 +1,88 @@
+package zlog
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var got []string
+	Config.Outputs = []OutputFunc{func(l Log) {
+		msg := l.Msg
+		if l.Err != nil {
+			msg = l.Err.Error()
+		}
+		got = append(got, fmt.Sprintf("%s %s %s", levelNames[l.Level], strings.Join(l.Modules, ":"), msg))
+	}}
+	defer Config.SetDebug("")
+
+	tests := []struct {
+		in   func()
+		want []string
+	}{
+		{func() {
+			NewWriter(Module("http"), LevelInfo).StdLogger().Print("hello\nworld")
+		}, []string{"info http hello", "info http world"}},
+
+		{func() {
+			l := NewWriter(Module("http"), LevelErr).
+				Flags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile).StdLogger()
+			l.Printf("oh noes")
+		}, []string{"error http oh noes"}},
+
+		{func() {
+			w := NewWriter(Module("http"), LevelInfo).Prefix("srv: ").Flags(log.LstdFlags)
+			l := log.New(w, "srv: ", log.LstdFlags)
+			l.Print("x")
+			w.Flags(log.LstdFlags | log.Lmsgprefix)
+			l.SetFlags(log.LstdFlags | log.Lmsgprefix)
+			l.Print("y")
+		}, []string{"info http x", "info http y"}},
+
+		// Only remove what the flags add.
+		{func() {
+			w := NewWriter(Module("http"), LevelInfo)
+			fmt.Fprintln(w, "12:00:00 backup started")
+			fmt.Fprintln(w, "main.go:3: x")
+			w.Flags(log.Ltime)
+			fmt.Fprintln(w, "2020/06/18 12:00:00 date")
+			fmt.Fprintln(w, "12:00:00 12:00:00 time")
+		}, []string{"info http 12:00:00 backup started", "info http main.go:3: x",
+			"info http 2020/06/18 12:00:00 date", "info http 12:00:00 time"}},
+
+		{func() {
+			l := NewWriter(Module("http"), LevelInfo).
+				Match(regexp.MustCompile(`^http: TLS handshake error`), LevelErr).
+				Match(regexp.MustCompile(`^http: `), LevelWarn).
+				StdLogger()
+			l.Print("http: TLS handshake error from 1.2.3.4: EOF")
+			l.Print("http: superfluous response.WriteHeader call")
+			l.Print("other")
+		}, []string{
+			"error http http: TLS handshake error from 1.2.3.4: EOF",
+			"warn http http: superfluous response.WriteHeader call",
+			"info http other",
+		}},
+
+		{func() {
+			w := NewWriter(Module("x"), LevelDbg)
+			fmt.Fprint(w, "par")
+			fmt.Fprint(w, "tial\r\n\nmore")
+			Config.SetDebug("x")
+			w.Flush()
+		}, []string{"debug x more"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			got = nil
+			tt.in()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package zlog
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
@@ -24,8 +27,10 @@ type LogConfig struct {
 	// Outputs for a Log entry.
 	//
 	// The default is to print to stderr for errors, and stdout for everything
-	// else. Generally you want to keep this as a backup and add additional
-	// outputs, instead of replacing this. For example:
+	// else, or to send it to journald if stderr is connected to the journal and
+	// Format is the default.
+	// Generally you want to keep this as a backup and add additional outputs,
+	// instead of replacing this. For example:
 	//
 	//    zlog.Config.Outputs = append(zlog.Config.Outputs, func(l Log) {
 	//        if l.Level != LevelErr { // Only process errors.
@@ -42,14 +47,51 @@ type LogConfig struct {
 	//
 	//        // .. send to external logging service ..
 	//    })
+	//
+	// NewSentryOutput() can be used to send errors to Sentry.
+	//
+	// Outputs are called synchronously, and only one output runs at a time.
+	// Use NewAsyncOutput() or NewAsyncSink() for slow outputs.
 	Outputs []OutputFunc
 
+	// Sinks are outputs which need to be flushed or closed, such as files or
+	// network connections. They're written to after Outputs.
+	//
+	// Use Flush() or Shutdown() to flush or close them.
+	Sinks []Sink
+
 	// Always print debug information for these modules. Debug will be enabled
 	// for all modules with the special word "all".
+	//
+	// Patterns without a ":" or "/" are matched against every module, and
+	// patterns with a ":" or "/" are matched against the full module path
+	// (e.g. "api:auth" for Module("api").Module("auth")). "*", "?" and "[..]"
+	// match within a module name as with path.Match, and "**" matches any
+	// number of modules:
+	//
+	//    api          api, api:auth, auth:api
+	//    api:*        api:auth, but not api or api:auth:oauth
+	//    api:**       api, api:auth, api:auth:oauth
+	//    **:oauth     oauth, api:auth:oauth
+	//
+	// A pattern starting with "-" disables debug for matching modules; this
+	// takes precedence over all other patterns, including those in
+	// Log.DebugModules.
 	Debug []string
 
+	// Minimum level to log for modules; entries with a lower level are
+	// discarded. The level for the last module that's in the map is used, and
+	// the special key "*" is used for entries without any listed modules.
+	// Everything is logged if no level is found.
+	//
+	// The order from low to high is trace, debug, info, warn, error, fatal.
+	// Setting the level to LevelDbg or LevelTrace also enables debug logs for
+	// that module, as if it was in Debug.
+	Levels map[string]int
+
 	// Format function used by the default stdout/stderr output. This takes a
-	// Log entry and formats it for output.
+	// Log entry and formats it for output. Setting this also stops the default
+	// output from sending entries to journald.
 	//
 	// TODO: the boundary between "outputs" and "zlog internals" are kinda leaky
 	// here; it's used for Trace() logs now. Should think about refactoring
@@ -66,6 +108,15 @@ type LogConfig struct {
 	//
 	// This is used in the standard format() function, not not elsewhere.
 	FmtTime string
+
+	// Exit code used by Fatal() and Fatalf(); the default is 1.
+	ExitCode int
+
+	// Redact sensitive data before any outputs are run. The default is to
+	// remove common headers such as Authorization and Cookie and fields such as
+	// "password", "secret", and "access_token", and to replace credit card
+	// numbers and bearer tokens with "[REDACTED]".
+	Redact Redact
 }
 
 // SetDebug sets the Debug field from a comma-separated list of module names.
@@ -75,8 +126,45 @@ func (c *LogConfig) SetDebug(d string) {
 	d = strings.TrimSpace(d)
 	if d == "" {
 		c.Debug = nil
+		return
 	}
 	c.Debug = strings.Split(d, ",")
+	for i := range c.Debug {
+		c.Debug[i] = strings.TrimSpace(c.Debug[i])
+	}
+}
+
+// SetLevels sets the Levels field from a comma-separated list of module=level
+// pairs, for example:
+//
+//	sql=error,http=debug,*=info
+func (c *LogConfig) SetLevels(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		c.mu.Lock()
+		c.Levels = nil
+		c.mu.Unlock()
+		return nil
+	}
+
+	levels := make(map[string]int)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		i := strings.IndexByte(p, '=')
+		if i == -1 {
+			return fmt.Errorf("zlog.SetLevels: no level in %q", p)
+		}
+		lvl, err := parseLevel(p[i+1:])
+		if err != nil {
+			return fmt.Errorf("zlog.SetLevels: %w", err)
+		}
+		levels[strings.TrimSpace(p[:i])] = lvl
+	}
+
+	c.mu.Lock()
+	c.Levels = levels
+	c.mu.Unlock()
+	return nil
 }
 
 func (c *LogConfig) SetFmtTime(f string) {
@@ -97,26 +185,114 @@ func (c *LogConfig) AppendOutputs(f ...OutputFunc) {
 	c.Outputs = append(c.Outputs, f...)
 }
 
+func (c *LogConfig) SetSinks(s ...Sink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Sinks = s
+}
+
+func (c *LogConfig) AppendSinks(s ...Sink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Sinks = append(c.Sinks, s...)
+}
+
 func (c LogConfig) RunOutputs(l Log) {
+	if l.Time.IsZero() {
+		l.Time = now()
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	l = c.Redact.apply(l)
 	for _, o := range c.Outputs {
 		o(l)
 	}
+	for _, s := range c.Sinks {
+		s.Write(l)
+	}
+}
+
+// Flush all sinks, returning the first error.
+func (c *LogConfig) Flush() error {
+	c.mu.Lock()
+	sinks := append([]Sink(nil), c.Sinks...)
+	c.mu.Unlock()
+
+	var firstErr error
+	for _, s := range sinks {
+		if err := s.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Shutdown flushes and closes all sinks, and removes them from the config.
+//
+// It returns ctx.Err() if the context is cancelled before all sinks are
+// closed, or the first error from Flush() or Close().
+func (c *LogConfig) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	sinks := c.Sinks
+	c.Sinks = nil
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		var firstErr error
+		for _, s := range sinks {
+			if err := s.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if err := s.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		done <- firstErr
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // OutputFunc is an output function, used in Config.Outputs.
 type OutputFunc func(Log)
 
+// Sink is an output which needs to be flushed or closed, used in Config.Sinks.
+//
+// Sinks are written to while holding a lock, so a slow Write blocks all
+// logging. The network outputs which send entries in batches (Loki, OTLP,
+// Fluent, Splunk, and Sentry) send them from a background goroutine, and only
+// block if a batch fills up while the previous one is still being sent;
+// errors are written to stderr together with the entries. Use NewAsyncSink()
+// for other slow sinks, such as SyslogOutput or GELFOutput over TCP.
+type Sink interface {
+	// Write the Log entry. Sinks are free to buffer entries.
+	Write(Log)
+
+	// Flush any buffered entries.
+	Flush() error
+
+	// Close the sink, after which it shouldn't be used any more.
+	Close() error
+}
+
 // Config for this package.
 var Config LogConfig
 
 func init() {
 	Config = LogConfig{
-		mu:      new(sync.Mutex),
-		FmtTime: "15:04:05 ",
-		Format:  format,
-		Outputs: []OutputFunc{output},
+		mu:       new(sync.Mutex),
+		FmtTime:  "15:04:05 ",
+		Format:   format,
+		Outputs:  []OutputFunc{output},
+		ExitCode: 1,
+		Redact:   defaultRedact(),
 	}
 }
 
@@ -126,21 +302,53 @@ const (
 	LevelErr   = 1
 	LevelDbg   = 2
 	LevelTrace = 3
+	LevelWarn  = 4
+	LevelFatal = 5
 )
 
 var now = time.Now
 
+// severity of a level, as levels constants aren't in order.
+var severity = map[int]int{
+	LevelTrace: 0,
+	LevelDbg:   1,
+	LevelInfo:  2,
+	LevelWarn:  3,
+	LevelErr:   4,
+	LevelFatal: 5,
+}
+
+// parseLevel parses a level name such as "info" or "error".
+func parseLevel(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug", "dbg":
+		return LevelDbg, nil
+	case "info", "print":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error", "err":
+		return LevelErr, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	return 0, fmt.Errorf("unknown level: %q", s)
+}
+
 type (
 	// Log module.
 	Log struct {
 		Ctx          context.Context
-		Msg          string   // Log message; set with Print(), Debug(), etc.
-		Err          error    // Original error, set with Error().
-		Level        int      // 0: print, 1: err, 2: debug, 3: trace
-		Modules      []string // Modules added to the logger.
-		Data         F        // Fields added to the logger.
-		DebugModules []string // List of modules to debug.
-		Traces       []string // Traces added to the logger.
+		Msg          string    // Log message; set with Print(), Debug(), etc.
+		Err          error     // Original error, set with Error().
+		Level        int       // 0: print, 1: err, 2: debug, 3: trace, 4: warn, 5: fatal
+		Modules      []string  // Modules added to the logger.
+		Data         F         // Fields added to the logger.
+		DebugModules []string  // List of modules to debug.
+		Traces       []string  // Traces added to the logger.
+		Time         time.Time // Time the entry was logged; set by RunOutputs().
 
 		since    time.Time
 		sinceLog F
@@ -162,6 +370,16 @@ func Print(v ...interface{})            { Log{}.Print(v...) }
 func Printf(f string, v ...interface{}) { Log{}.Printf(f, v...) }
 func Error(err error)                   { Log{}.Error(err) }
 func Errorf(f string, v ...interface{}) { Log{}.Errorf(f, v...) }
+func Warn(v ...interface{})             { Log{}.Warn(v...) }
+func Warnf(f string, v ...interface{})  { Log{}.Warnf(f, v...) }
+func Fatal(err error)                   { Log{}.Fatal(err) }
+func Fatalf(f string, v ...interface{}) { Log{}.Fatalf(f, v...) }
+
+// Flush all sinks in Config.
+func Flush() error { return Config.Flush() }
+
+// Shutdown flushes and closes all sinks in Config.
+func Shutdown(ctx context.Context) error { return Config.Shutdown(ctx) }
 
 // FieldsRequest adds information from a HTTP request as fields.
 func FieldsRequest(r *http.Request) Log { return Log{}.FieldsRequest(r) }
@@ -169,6 +387,15 @@ func FieldsRequest(r *http.Request) Log { return Log{}.FieldsRequest(r) }
 // FieldsLocation records the caller location.
 func FieldsLocation() Log { return Log{}.FieldsLocation() }
 
+// timestamp gets the time the entry was logged, or the current time if it's
+// not set.
+func (l Log) timestamp() time.Time {
+	if l.Time.IsZero() {
+		return now()
+	}
+	return l.Time
+}
+
 // ResetTrace removes all trace logs added with Trace() and Tracef().
 func (l Log) ResetTrace() Log {
 	l.Traces = nil
@@ -177,8 +404,12 @@ func (l Log) ResetTrace() Log {
 
 // Context adds a context to the Log entry.
 //
-// This isn't used by zlog, and mostly so that outputs can use it if needed.
-func (l Log) Context(ctx context.Context) { l.Ctx = ctx }
+// This isn't used by zlog, and mostly so that outputs can use it if needed; see
+// RequestID() and TraceID().
+func (l Log) Context(ctx context.Context) Log {
+	l.Ctx = ctx
+	return l
+}
 
 func (l Log) SetDebug(m ...string) Log {
 	l.DebugModules = append(l.DebugModules, m...)
@@ -211,6 +442,9 @@ func (l Log) Field(k string, v interface{}) Log {
 
 // Print an informational error.
 func (l Log) Print(v ...interface{}) {
+	if !l.allowed(LevelInfo) {
+		return
+	}
 	l.Msg = fmt.Sprint(v...)
 	l.Level = LevelInfo
 	Config.RunOutputs(l)
@@ -218,6 +452,9 @@ func (l Log) Print(v ...interface{}) {
 
 // Printf an informational error.
 func (l Log) Printf(f string, v ...interface{}) {
+	if !l.allowed(LevelInfo) {
+		return
+	}
 	l.Msg = fmt.Sprintf(f, v...)
 	l.Level = LevelInfo
 	Config.RunOutputs(l)
@@ -225,6 +462,9 @@ func (l Log) Printf(f string, v ...interface{}) {
 
 // Error prints an error.
 func (l Log) Error(err error) {
+	if !l.allowed(LevelErr) {
+		return
+	}
 	l.Err = err
 	l.Level = LevelErr
 	Config.RunOutputs(l)
@@ -232,15 +472,56 @@ func (l Log) Error(err error) {
 
 // Errorf prints an error.
 func (l Log) Errorf(f string, v ...interface{}) {
+	if !l.allowed(LevelErr) {
+		return
+	}
 	l.Err = fmt.Errorf(f, v...)
 	l.Level = LevelErr
 	Config.RunOutputs(l)
 }
 
+// Warn prints a warning.
+func (l Log) Warn(v ...interface{}) {
+	if !l.allowed(LevelWarn) {
+		return
+	}
+	l.Msg = fmt.Sprint(v...)
+	l.Level = LevelWarn
+	Config.RunOutputs(l)
+}
+
+// Warnf prints a warning.
+func (l Log) Warnf(f string, v ...interface{}) {
+	if !l.allowed(LevelWarn) {
+		return
+	}
+	l.Msg = fmt.Sprintf(f, v...)
+	l.Level = LevelWarn
+	Config.RunOutputs(l)
+}
+
+// Fatal prints an error, flushes all sinks, and exits with Config.ExitCode.
+func (l Log) Fatal(err error) {
+	l.Err = err
+	l.Level = LevelFatal
+	Config.RunOutputs(l)
+	Flush()
+	exit(Config.ExitCode)
+}
+
+// Fatalf prints an error, flushes all sinks, and exits with Config.ExitCode.
+func (l Log) Fatalf(f string, v ...interface{}) {
+	l.Err = fmt.Errorf(f, v...)
+	l.Level = LevelFatal
+	Config.RunOutputs(l)
+	Flush()
+	exit(Config.ExitCode)
+}
+
 // Debug records debugging information. This won't do anything if the current
 // module isn't beind debugged.
 func (l Log) Debug(v ...interface{}) {
-	if !l.hasDebug() {
+	if !l.hasDebug() || !l.allowed(LevelDbg) {
 		return
 	}
 	l.Msg = fmt.Sprint(v...)
@@ -251,7 +532,7 @@ func (l Log) Debug(v ...interface{}) {
 // Debugf records debugging information. This won't do anything if the current
 // module isn't beind debugged.
 func (l Log) Debugf(f string, v ...interface{}) {
-	if !l.hasDebug() {
+	if !l.hasDebug() || !l.allowed(LevelDbg) {
 		return
 	}
 	l.Msg = fmt.Sprintf(f, v...)
@@ -262,24 +543,29 @@ func (l Log) Debugf(f string, v ...interface{}) {
 func (l Log) Trace(v ...interface{}) Log {
 	l.Msg = fmt.Sprint(v...)
 	l.Level = LevelTrace
-	if l.hasDebug() {
+	if l.hasDebug() && l.allowed(LevelTrace) {
 		Config.RunOutputs(l)
 		return l
 	}
 
-	l.Traces = append(l.Traces, Config.Format(l))
-	return l
+	return l.addTrace()
 }
 
 func (l Log) Tracef(f string, v ...interface{}) Log {
 	l.Msg = fmt.Sprintf(f, v...)
 	l.Level = LevelTrace
-	if l.hasDebug() {
+	if l.hasDebug() && l.allowed(LevelTrace) {
 		Config.RunOutputs(l)
 		return l
 	}
 
-	l.Traces = append(l.Traces, Config.Format(l))
+	return l.addTrace()
+}
+
+// addTrace records the formatted entry in Traces. Data is redacted first, as
+// the trace is only a string by the time it reaches RunOutputs.
+func (l Log) addTrace() Log {
+	l.Traces = append(l.Traces, Config.Format(Config.Redact.apply(l)))
 	return l
 }
 
@@ -287,6 +573,9 @@ func (l Log) Tracef(f string, v ...interface{}) Log {
 func (l Log) FieldsSince() Log { return l.Fields(l.sinceLog) }
 
 // FieldsRequest adds information from a HTTP request as fields.
+//
+// Headers in Config.Redact.Headers and form and query parameters in
+// Config.Redact.Fields are removed or masked.
 func (l Log) FieldsRequest(r *http.Request) Log {
 	if r == nil {
 		panic("zlog.FieldsRequest: *http.Request is nil")
@@ -299,13 +588,33 @@ func (l Log) FieldsRequest(r *http.Request) Log {
 	}
 	sort.Strings(h)
 
+	red := Config.Redact
+	u := *r.URL
+	if u.RawQuery != "" {
+		// Don't re-encode if nothing changed, as that changes the order.
+		if q := u.Query(); red.values(q) {
+			u.RawQuery = q.Encode()
+		}
+	}
+	form := url.Values{}
+	for k, v := range r.Form {
+		form[k] = v
+	}
+	red.values(form)
+
 	f := F{
 		"http_method": r.Method,
-		"http_url":    r.URL.String(),
-		"http_form":   r.Form.Encode(),
+		"http_url":    u.String(),
+		"http_form":   form.Encode(),
 		"http_host":   r.Host,
 	}
 	for _, k := range h {
+		if red.header(k) {
+			if red.Mask != "" {
+				f["http."+k] = red.Mask
+			}
+			continue
+		}
 		f["http."+k] = r.Header.Get(k)
 	}
 
@@ -320,24 +629,115 @@ func (l Log) FieldsLocation() Log {
 	return l
 }
 
+// Enabled reports if an entry with this level would be logged, according to
+// Config.Levels and the debug modules.
+func (l Log) Enabled(level int) bool {
+	if level == LevelDbg || level == LevelTrace {
+		return l.hasDebug() && l.allowed(level)
+	}
+	return l.allowed(level)
+}
+
+// minLevel gets the minimum level from Config.Levels; the bool is false if
+// there is no level.
+func (l Log) minLevel() (int, bool) {
+	if len(Config.Levels) == 0 {
+		return 0, false
+	}
+	for i := len(l.Modules) - 1; i >= 0; i-- {
+		if lvl, ok := Config.Levels[l.Modules[i]]; ok {
+			return lvl, true
+		}
+	}
+	lvl, ok := Config.Levels["*"]
+	return lvl, ok
+}
+
+// allowed reports if entries with this level should be logged according to
+// Config.Levels.
+func (l Log) allowed(level int) bool {
+	min, ok := l.minLevel()
+	return !ok || severity[level] >= severity[min]
+}
+
 func (l Log) hasDebug() bool {
-	for _, m := range l.Modules {
-		for _, d := range Config.Debug {
-			if d == "all" || d == m {
-				return true
+	if len(l.Modules) == 0 {
+		return l.debugLevel()
+	}
+
+	mods := splitModules(strings.Join(l.Modules, ":"))
+	match := false
+	for _, list := range [][]string{Config.Debug, l.DebugModules} {
+		for _, d := range list {
+			if strings.HasPrefix(d, "-") {
+				if matchModule(d[1:], mods) {
+					return false
+				}
+				continue
+			}
+			if !match && matchModule(d, mods) {
+				match = true
 			}
 		}
+	}
+	return match || l.debugLevel()
+}
+
+// debugLevel reports if the minimum level from Config.Levels enables debug.
+func (l Log) debugLevel() bool {
+	min, ok := l.minLevel()
+	return ok && (min == LevelDbg || min == LevelTrace)
+}
+
+func splitModules(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '/' })
+}
 
-		for _, d := range l.DebugModules {
-			if d == "all" || d == m {
+// matchModule reports if the pattern matches the module path; see
+// LogConfig.Debug.
+func matchModule(pattern string, mods []string) bool {
+	if pattern == "all" {
+		return true
+	}
+
+	pat := splitModules(pattern)
+	if len(pat) == 1 && pat[0] != "**" {
+		for _, m := range mods {
+			if ok, _ := path.Match(pat[0], m); ok {
 				return true
 			}
 		}
+		return false
 	}
-	return false
+	return matchPath(pat, mods)
 }
 
-var stderr io.Writer = os.Stderr // So we can swap it out in test.
+func matchPath(pat, mods []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(mods); i++ {
+				if matchPath(pat[1:], mods[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(mods) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], mods[0]); !ok {
+			return false
+		}
+		pat, mods = pat[1:], mods[1:]
+	}
+	return len(mods) == 0
+}
+
+var (
+	stderr io.Writer = os.Stderr // So we can swap it out in test.
+	exit             = os.Exit
+)
 
 // Since records the duration since the last Since() or Module() call with the
 // given message.
@@ -376,7 +776,8 @@ func (l Log) Since(msg string) Log {
 
 // Recover from a panic.
 //
-// Any panics will be recover()'d and reported with Error():
+// Any panics will be recover()'d and reported with Error(), after which all
+// sinks are flushed:
 //
 //	go func() {
 //	    defer zlog.Recover()
@@ -408,9 +809,10 @@ func Recover(cb ...func(Log) Log) {
 		l = cb[0](l)
 	}
 
-	err = fmt.Errorf("%s\n%s", err, debug.Stack())
+	err = &stackError{err: err, stack: debug.Stack()}
 
 	l.Error(err)
+	Flush()
 
 	if len(cb) > 1 {
 		for i := range cb[1:] {
@@ -419,6 +821,27 @@ func Recover(cb ...func(Log) Log) {
 	}
 }
 
+// stackError is an error with the stack trace from Recover(); the stack is
+// added to the error text, so it's printed by the text outputs, and the
+// structured outputs can get the stack with errorStack().
+type stackError struct {
+	err   error
+	stack []byte
+}
+
+func (e *stackError) Error() string { return fmt.Sprintf("%s\n%s", e.err, e.stack) }
+func (e *stackError) Unwrap() error { return e.err }
+
+// errorStack gets the stack trace and the error without the stack trace if the
+// error is from Recover().
+func errorStack(err error) (stack string, cause error) {
+	var s *stackError
+	if errors.As(err, &s) {
+		return strings.TrimRight(string(s.stack), "\n"), s.err
+	}
+	return "", err
+}
+
 // ProfileCPU writes a memory if the path is non-empty. This should be called on
 // start and the returned function on end (e.g. defer):
 //
@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -29,6 +30,9 @@ func TestLog(t *testing.T) {
 		{func() { Error(errors.New("w00t")) }, "ERROR: w00t"},
 		{func() { Errorf("w00t %s", "x") }, "ERROR: w00t x"},
 
+		{func() { Warn("w00t") }, "WARN: w00t"},
+		{func() { Warnf("w00t %s", "x") }, "WARN: w00t x"},
+
 		{func() { Module("test").Print("w00t") }, "test: INFO: w00t"},
 		{func() { Module("test").Module("second").Print("w00t") }, "test: second: INFO: w00t"},
 		{func() { Module("test").Error(errors.New("w00t")) }, "test: ERROR: w00t"},
@@ -201,6 +205,253 @@ func TestSince(t *testing.T) {
 	})
 }
 
+func TestHasDebug(t *testing.T) {
+	defer Config.SetDebug("")
+
+	tests := []struct {
+		debug   string
+		modules []string
+		local   []string
+		want    bool
+	}{
+		{"", []string{"api"}, nil, false},
+		{"all", nil, nil, false},
+		{"all", []string{"api"}, nil, true},
+		{"*", []string{"api"}, nil, true},
+		{"**", []string{"api", "auth"}, nil, true},
+
+		// Plain names match any module.
+		{"api", []string{"api"}, nil, true},
+		{"api", []string{"api", "auth"}, nil, true},
+		{"auth", []string{"api", "auth"}, nil, true},
+		{"xxx", []string{"api", "auth"}, nil, false},
+		{"ap*", []string{"x", "api"}, nil, true},
+
+		// Paths match the full path.
+		{"api:auth", []string{"api", "auth"}, nil, true},
+		{"api/auth", []string{"api", "auth"}, nil, true},
+		{"api:auth", []string{"api:auth"}, nil, true},
+		{"api:auth", []string{"api"}, nil, false},
+		{"api:auth", []string{"api", "auth", "oauth"}, nil, false},
+		{"api:*", []string{"api"}, nil, false},
+		{"api:*", []string{"api", "auth"}, nil, true},
+		{"api:*", []string{"api", "auth", "oauth"}, nil, false},
+		{"api:**", []string{"api"}, nil, true},
+		{"api/**", []string{"api", "auth", "oauth"}, nil, true},
+		{"api/**", []string{"x", "api"}, nil, false},
+		{"**:oauth", []string{"api", "auth", "oauth"}, nil, true},
+		{"api:**:oauth", []string{"api", "oauth"}, nil, true},
+		{"api:**:oauth", []string{"api", "auth", "x", "oauth"}, nil, true},
+		{"api:**:oauth", []string{"api", "auth"}, nil, false},
+
+		// Negations take precedence, regardless of order.
+		{"api:**,-api:auth", []string{"api", "auth"}, nil, false},
+		{"-api:auth,api:**", []string{"api", "auth"}, nil, false},
+		{"api:**,-api:auth", []string{"api", "other"}, nil, true},
+		{"api:**,-api:auth", []string{"api", "auth", "oauth"}, nil, true},
+		{"api:**,-api:auth:**", []string{"api", "auth", "oauth"}, nil, false},
+		{"all,-auth", []string{"api", "auth"}, nil, false},
+		{"-auth", []string{"api", "auth"}, []string{"api"}, false},
+		{"all", []string{"api", "auth"}, []string{"-auth"}, false},
+		{"", []string{"api", "auth"}, []string{"api:*"}, true},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			Config.SetDebug(tt.debug)
+			l := Log{Modules: tt.modules, DebugModules: tt.local}
+			if got := l.hasDebug(); got != tt.want {
+				t.Errorf("%q for %q (local %q): got %t; want %t", tt.debug, tt.modules, tt.local, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevels(t *testing.T) {
+	n := time.Now()
+	now = func() time.Time { return n }
+	enableColors = false
+	defer Config.SetLevels("")
+
+	tests := []struct {
+		levels string
+		in     func()
+		want   string
+	}{
+		{"", func() { Module("sql").Print("w00t") }, "sql: INFO: w00t"},
+		{"sql=error", func() { Module("sql").Print("w00t") }, ""},
+		{"sql=error", func() { Module("sql").Warn("w00t") }, ""},
+		{"sql=error", func() { Module("sql").Errorf("w00t") }, "sql: ERROR: w00t"},
+		{"sql=error", func() { Module("http").Print("w00t") }, "http: INFO: w00t"},
+		{"sql=error", func() { Print("w00t") }, "INFO: w00t"},
+		{"sql=error,*=warn", func() { Module("http").Print("w00t") }, ""},
+		{"sql=error,*=warn", func() { Print("w00t") }, ""},
+		{"sql=error,*=warn", func() { Warn("w00t") }, "WARN: w00t"},
+		{"sql=error, http=debug, *=info", func() { Module("http").Debug("w00t") }, "http: DEBUG: w00t"},
+		{"sql=error, http=debug, *=info", func() { Module("http").Trace("w00t") }, ""},
+		{"sql=error,http=debug,*=info", func() { Module("other").Debug("w00t") }, ""},
+		{"*=trace", func() { Module("other").Trace("w00t") }, "other: TRACE: w00t"},
+		{"*=debug", func() { Log{}.Debug("w00t") }, "DEBUG: w00t"},
+		{"*=trace", func() { Log{}.Trace("w00t") }, "TRACE: w00t"},
+		{"*=info", func() { Log{}.Debug("w00t") }, ""},
+		{"sql=error", func() { SetDebug("sql").Module("sql").Debug("w00t") }, ""},
+
+		// Last module takes precedence.
+		{"sql=error,http=info", func() { Module("http").Module("sql").Print("w00t") }, ""},
+		{"sql=error,http=info", func() { Module("sql").Module("http").Print("w00t") }, "sql: http: INFO: w00t"},
+		{"sql=error,http=info", func() { Module("sql").Module("other").Print("w00t") }, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			if err := Config.SetLevels(tt.levels); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			Config.Outputs = []OutputFunc{
+				func(l Log) { buf.WriteString(Config.Format(l)) },
+			}
+
+			tt.in()
+			out := buf.String()
+			if tt.want != "" {
+				tt.want = n.Format(Config.FmtTime) + tt.want
+			}
+			if out != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s\n", out, tt.want)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, l := range []string{"sql", "sql=xxx", "sql=info,http"} {
+			if err := Config.SetLevels(l); err == nil {
+				t.Errorf("no error for %q", l)
+			}
+		}
+	})
+}
+
+func TestFatal(t *testing.T) {
+	n := time.Now()
+	now = func() time.Time { return n }
+	enableColors = false
+
+	var (
+		buf  bytes.Buffer
+		code = -1
+	)
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	Config.Outputs = []OutputFunc{
+		func(l Log) { buf.WriteString(Config.Format(l)) },
+	}
+
+	Module("test").Trace("w00t").Fatalf("oh %s", "noes")
+
+	want := n.Format(Config.FmtTime) + "test: TRACE: w00t\n" + n.Format(Config.FmtTime) + "test: FATAL: oh noes"
+	if out := buf.String(); out != want {
+		t.Errorf("\nout:  %q\nwant: %q", out, want)
+	}
+	if code != 1 {
+		t.Errorf("exit code %d", code)
+	}
+
+	Config.ExitCode = 2
+	defer func() { Config.ExitCode = 1 }()
+	Fatal(errors.New("x"))
+	if code != 2 {
+		t.Errorf("exit code %d", code)
+	}
+}
+
+type testSink struct {
+	mu     sync.Mutex
+	block  chan struct{}
+	events []string
+}
+
+func (s *testSink) add(e string) {
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	s.mu.Unlock()
+}
+func (s *testSink) Write(l Log) { s.add("write " + l.Msg) }
+func (s *testSink) Flush() error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.add("flush")
+	return nil
+}
+func (s *testSink) Close() error { s.add("close"); return errors.New("close error") }
+
+func TestSinks(t *testing.T) {
+	defer func() { exit = os.Exit }()
+	defer func(o []OutputFunc) { Config.Outputs = o }(Config.Outputs)
+	Config.Outputs = nil
+	defer Config.SetSinks()
+
+	t.Run("shutdown", func(t *testing.T) {
+		s := &testSink{}
+		Config.SetSinks(s)
+		Print("1")
+		if err := Flush(); err != nil {
+			t.Fatal(err)
+		}
+		Print("2")
+		err := Shutdown(context.Background())
+		if err == nil || err.Error() != "close error" {
+			t.Errorf("wrong error: %v", err)
+		}
+		Print("3") // Removed from config.
+
+		want := "write 1 flush write 2 flush close"
+		if out := strings.Join(s.events, " "); out != want {
+			t.Errorf("\nout:  %s\nwant: %s", out, want)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		s := &testSink{block: make(chan struct{})}
+		defer close(s.block)
+		Config.SetSinks(s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("fatal", func(t *testing.T) {
+		s := &testSink{}
+		Config.SetSinks(s)
+		exit = func(int) { s.add("exit") }
+		Fatalf("oh noes")
+
+		want := "write  flush exit"
+		if out := strings.Join(s.events, " "); out != want {
+			t.Errorf("\nout:  %s\nwant: %s", out, want)
+		}
+	})
+
+	t.Run("recover", func(t *testing.T) {
+		s := &testSink{}
+		Config.SetSinks(s)
+		func() {
+			defer Recover()
+			panic("oh noes")
+		}()
+
+		want := "write  flush"
+		if out := strings.Join(s.events, " "); out != want {
+			t.Errorf("\nout:  %s\nwant: %s", out, want)
+		}
+	})
+}
+
 // TODO: expand test (i.e. test that it works beyond running).
 func TestRecover(t *testing.T) {
 	go func() {
@@ -0,0 +1,48 @@
+//go:build go1.21
+// +build go1.21
+
+package zslog
+
+import (
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zgo.at/zlog"
+)
+
+func TestJournaldLocation(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "socket")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	j, err := zlog.NewJournaldOutput(zlog.JournaldOptions{Socket: sock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	outputs := zlog.Config.Outputs
+	zlog.Config.SetOutputs(j.Write)
+	defer zlog.Config.SetOutputs(outputs...)
+
+	slog.New(NewHandler(zlog.Log{})).Info("w00t")
+
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := ln.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	if !strings.Contains(got, "journald_linux_test.go\n") ||
+		!strings.Contains(got, "\nCODE_FUNC=zgo.at/zlog/zslog.TestJournaldLocation\n") {
+		t.Errorf("wrong location: %q", got)
+	}
+}
@@ -0,0 +1,220 @@
+//go:build go1.21
+// +build go1.21
+
+// Package zslog connects zlog and log/slog.
+package zslog
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"zgo.at/zlog"
+)
+
+// Level converts a slog level to a zlog level.
+//
+// Levels below slog.LevelDebug are mapped to zlog.LevelTrace, and levels of
+// slog.LevelError+4 and higher to zlog.LevelFatal (this won't exit).
+func Level(l slog.Level) int {
+	switch {
+	case l < slog.LevelDebug:
+		return zlog.LevelTrace
+	case l < slog.LevelInfo:
+		return zlog.LevelDbg
+	case l < slog.LevelWarn:
+		return zlog.LevelInfo
+	case l < slog.LevelError:
+		return zlog.LevelWarn
+	case l < slog.LevelError+4:
+		return zlog.LevelErr
+	default:
+		return zlog.LevelFatal
+	}
+}
+
+// SlogLevel converts a zlog level to a slog level.
+func SlogLevel(l int) slog.Level {
+	switch l {
+	case zlog.LevelTrace:
+		return slog.LevelDebug - 4
+	case zlog.LevelDbg:
+		return slog.LevelDebug
+	case zlog.LevelWarn:
+		return slog.LevelWarn
+	case zlog.LevelErr:
+		return slog.LevelError
+	case zlog.LevelFatal:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Output creates a zlog output which sends entries to the slog handler h, for
+// example:
+//
+//	zlog.Config.AppendOutputs(zslog.Output(slog.NewJSONHandler(os.Stdout, nil)))
+//
+// Modules are added as groups, fields as attributes, and Log.Err as an "error"
+// attribute. The message is Log.Msg, or Log.Err if Msg is empty.
+//
+// Don't use this with Handler, as that would loop forever.
+func Output(h slog.Handler) zlog.OutputFunc {
+	return func(l zlog.Log) {
+		ctx := l.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		hh := h
+		for _, m := range l.Modules {
+			hh = hh.WithGroup(m)
+		}
+
+		level := SlogLevel(l.Level)
+		if !hh.Enabled(ctx, level) {
+			return
+		}
+
+		t := l.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		msg := l.Msg
+		if msg == "" && l.Err != nil {
+			msg = l.Err.Error()
+		}
+
+		r := slog.NewRecord(t, level, msg, 0)
+		keys := make([]string, 0, len(l.Data))
+		for k := range l.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r.AddAttrs(slog.Any(k, l.Data[k]))
+		}
+		if l.Err != nil {
+			r.AddAttrs(slog.Any("error", l.Err))
+		}
+
+		hh.Handle(ctx, r)
+	}
+}
+
+// Handler is a slog.Handler which sends records to zlog.Config.RunOutputs().
+//
+// Groups are added as modules, and attributes as fields. An attribute with the
+// key "err" or "error" is used as Log.Err if the level is error or higher; note
+// the default zlog format will only print the error and not the message in that
+// case.
+//
+//	slog.SetDefault(slog.New(zslog.NewHandler(zlog.Module("app"))))
+type Handler struct {
+	l zlog.Log
+}
+
+var _ slog.Handler = &Handler{}
+
+// NewHandler creates a new handler, using l as the base for all entries.
+func NewHandler(l zlog.Log) *Handler {
+	return &Handler{l: l}
+}
+
+// Enabled reports if the level is enabled for this handler's modules.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.l.Enabled(Level(level))
+}
+
+// Handle the record.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.l
+	if ctx != nil {
+		l.Ctx = ctx
+	}
+	l.Time = r.Time
+	l.Level = Level(r.Level)
+	l.Msg = r.Message
+
+	data := make(zlog.F, len(l.Data)+r.NumAttrs())
+	for k, v := range l.Data {
+		data[k] = v
+	}
+	isErr := l.Level == zlog.LevelErr || l.Level == zlog.LevelFatal
+	r.Attrs(func(a slog.Attr) bool {
+		if err, ok := errorAttr(a); ok && isErr && l.Err == nil {
+			l.Err = err
+			return true
+		}
+		addAttr(data, "", a)
+		return true
+	})
+	if l.Err != nil && l.Msg == l.Err.Error() {
+		l.Msg = "" // From Output()
+	}
+	l.Data = nil
+	if len(data) > 0 {
+		l.Data = data
+	}
+
+	zlog.Config.RunOutputs(l)
+	return nil
+}
+
+// WithAttrs returns a new handler with the attributes added as fields.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	data := make(zlog.F, len(h.l.Data)+len(attrs))
+	for k, v := range h.l.Data {
+		data[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(data, "", a)
+	}
+
+	l := h.l
+	l.Data = data
+	return &Handler{l: l}
+}
+
+// WithGroup returns a new handler with the group added as a module.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{l: h.l.Module(name)}
+}
+
+func errorAttr(a slog.Attr) (error, bool) {
+	if a.Key != "err" && a.Key != "error" {
+		return nil, false
+	}
+	err, ok := a.Value.Resolve().Any().(error)
+	return err, ok && err != nil
+}
+
+// addAttr adds the attribute to data; group attributes are added as
+// "group.key".
+func addAttr(data zlog.F, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if a.Key == "" && v.Any() == nil {
+		return
+	}
+
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(data, prefix, ga)
+		}
+		return
+	}
+
+	data[prefix+a.Key] = v.Any()
+}
@@ -0,0 +1,199 @@
+//go:build go1.21
+// +build go1.21
+
+package zslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zgo.at/zlog"
+)
+
+func capture(t *testing.T) *[]zlog.Log {
+	var logs []zlog.Log
+	outputs := zlog.Config.Outputs
+	zlog.Config.SetOutputs(func(l zlog.Log) { logs = append(logs, l) })
+	t.Cleanup(func() {
+		zlog.Config.SetOutputs(outputs...)
+		zlog.Config.SetDebug("")
+	})
+	return &logs
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		in   slog.Level
+		want int
+	}{
+		{slog.LevelDebug - 10, zlog.LevelTrace},
+		{slog.LevelDebug - 4, zlog.LevelTrace},
+		{slog.LevelDebug - 1, zlog.LevelTrace},
+		{slog.LevelDebug, zlog.LevelDbg},
+		{slog.LevelInfo - 1, zlog.LevelDbg},
+		{slog.LevelInfo, zlog.LevelInfo},
+		{slog.LevelInfo + 2, zlog.LevelInfo},
+		{slog.LevelWarn, zlog.LevelWarn},
+		{slog.LevelError, zlog.LevelErr},
+		{slog.LevelError + 4, zlog.LevelFatal},
+		{slog.LevelError + 10, zlog.LevelFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in.String(), func(t *testing.T) {
+			if got := Level(tt.in); got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+
+	for _, l := range []int{zlog.LevelTrace, zlog.LevelDbg, zlog.LevelInfo, zlog.LevelWarn, zlog.LevelErr, zlog.LevelFatal} {
+		if got := Level(SlogLevel(l)); got != l {
+			t.Errorf("round-trip for %d: got %d", l, got)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	logs := capture(t)
+	log := slog.New(NewHandler(zlog.Module("app")))
+
+	log.Info("hello", "k", "v", "n", 42)
+	log.WithGroup("sql").With("db", "main").Warn("slow", slog.Group("q", "ms", 200))
+	log.Error("failed", "err", errors.New("oh noes"), "id", 1)
+	log.Info("not an error", "err", errors.New("x"))
+	log.Debug("not logged")
+
+	want := []zlog.Log{
+		{Modules: []string{"app"}, Level: zlog.LevelInfo, Msg: "hello", Data: zlog.F{"k": "v", "n": int64(42)}},
+		{Modules: []string{"app", "sql"}, Level: zlog.LevelWarn, Msg: "slow", Data: zlog.F{"db": "main", "q.ms": int64(200)}},
+		{Modules: []string{"app"}, Level: zlog.LevelErr, Msg: "failed", Err: errors.New("oh noes"), Data: zlog.F{"id": int64(1)}},
+		{Modules: []string{"app"}, Level: zlog.LevelInfo, Msg: "not an error", Data: zlog.F{"err": errors.New("x")}},
+	}
+	compare(t, *logs, want)
+}
+
+func TestHandlerDebug(t *testing.T) {
+	logs := capture(t)
+	zlog.Config.SetDebug("app:sql")
+
+	h := NewHandler(zlog.Module("app"))
+	log := slog.New(h)
+	log.Debug("not logged")
+	log.WithGroup("sql").Debug("logged")
+
+	if len(*logs) != 1 || (*logs)[0].Msg != "logged" || (*logs)[0].Level != zlog.LevelDbg {
+		t.Errorf("%#v", *logs)
+	}
+}
+
+func compare(t *testing.T, got, want []zlog.Log) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries; want %d\n%#v", len(got), len(want), got)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if !reflect.DeepEqual(g.Modules, w.Modules) || g.Level != w.Level || g.Msg != w.Msg ||
+			fmt.Sprint(g.Err) != fmt.Sprint(w.Err) || !reflect.DeepEqual(g.Data, w.Data) {
+			t.Errorf("entry %d:\ngot:  %v %d %q %v %#v\nwant: %v %d %q %v %#v", i,
+				g.Modules, g.Level, g.Msg, g.Err, g.Data, w.Modules, w.Level, w.Msg, w.Err, w.Data)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	buf := new(bytes.Buffer)
+	out := Output(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug - 4,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	tests := []struct {
+		in   zlog.Log
+		want string
+	}{
+		{zlog.Log{Msg: "hello"}, `level=INFO msg=hello`},
+		{zlog.Log{Level: zlog.LevelTrace, Msg: "t", Modules: []string{"a"}}, `level=DEBUG-4 msg=t`},
+		{zlog.Log{Level: zlog.LevelWarn, Msg: "w", Modules: []string{"a", "b"}, Data: zlog.F{"k": "v", "n": 1}},
+			`level=WARN msg=w a.b.k=v a.b.n=1`},
+		{zlog.Log{Level: zlog.LevelErr, Err: errors.New("oh noes"), Data: zlog.F{"k": "v"}},
+			`level=ERROR msg="oh noes" k=v error="oh noes"`},
+		{zlog.Log{Level: zlog.LevelFatal, Msg: "ctx", Err: errors.New("oh noes")},
+			`level=ERROR+4 msg=ctx error="oh noes"`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			buf.Reset()
+			out(tt.in)
+			if got := strings.TrimSpace(buf.String()); got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Run("zlog", func(t *testing.T) {
+		logs := capture(t)
+		out := Output(NewHandler(zlog.Log{}))
+
+		in := []zlog.Log{
+			{Level: zlog.LevelInfo, Msg: "hello", Modules: []string{"a", "b"}, Data: zlog.F{"k": "v", "n": int64(1)}},
+			{Level: zlog.LevelTrace, Msg: "t", Modules: []string{"a"}},
+			{Level: zlog.LevelDbg, Msg: "d", Modules: []string{"a"}},
+			{Level: zlog.LevelWarn, Msg: "w"},
+			{Level: zlog.LevelErr, Err: errors.New("oh noes"), Modules: []string{"a"}},
+			{Level: zlog.LevelErr, Msg: "ctx", Err: errors.New("oh noes")},
+			{Level: zlog.LevelFatal, Err: errors.New("oh noes"), Data: zlog.F{"k": zlog.JSON(`{}`)}},
+		}
+		zlog.Config.SetDebug("all")
+		for _, l := range in {
+			out(l)
+		}
+		compare(t, *logs, in)
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		text := slog.NewTextHandler(buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug - 4,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		zlog.Config.SetOutputs(Output(text))
+		defer zlog.Config.SetOutputs()
+		zlog.Config.SetDebug("all")
+		defer zlog.Config.SetDebug("")
+
+		log := slog.New(NewHandler(zlog.Log{}))
+		log.Info("hello", "k", "v")
+		log.WithGroup("a").Log(nil, slog.LevelDebug-4, "trace")
+		log.WithGroup("a").WithGroup("b").Warn("w", "n", 1)
+		log.Error("ctx", "error", errors.New("oh noes"))
+
+		want := strings.Join([]string{
+			`level=INFO msg=hello k=v`,
+			`level=DEBUG-4 msg=trace`,
+			`level=WARN msg=w a.b.n=1`,
+			`level=ERROR msg=ctx error="oh noes"`,
+		}, "\n")
+		if got := strings.TrimSpace(buf.String()); got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}